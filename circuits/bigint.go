@@ -0,0 +1,82 @@
+package circuits
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/emulated/emparams"
+	"github.com/consensys/gnark/std/math/uints"
+	common_utils "github.com/lightec-xyz/common/utils"
+	"math/big"
+)
+
+// BigIntParams is used to emulate unsigned integers wider than the native field. Every value
+// handled with it stays far below 2^512-1, so modular and integer arithmetic coincide.
+type BigIntParams = emparams.Mod1e512
+type BigInt = emulated.Element[BigIntParams]
+
+// BigIntFromBytes composes little-endian bytes into a BigInt.
+func BigIntFromBytes(api frontend.API, f *emulated.Field[BigIntParams], data []uints.U8) *BigInt {
+	vars := make([]frontend.Variable, len(data))
+	for i := range data {
+		vars[i] = data[i].Val
+	}
+	return bigIntFromVars(api, f, vars)
+}
+
+func bigIntFromVars(api frontend.API, f *emulated.Field[BigIntParams], data []frontend.Variable) *BigInt {
+	var params BigIntParams
+	bytesPerLimb := int(params.BitsPerLimb() / 8)
+	if len(data) > bytesPerLimb*int(params.NbLimbs()) {
+		panic("data longer than expected")
+	}
+
+	limbs := make([]frontend.Variable, params.NbLimbs())
+	for i := range limbs {
+		limbs[i] = frontend.Variable(0)
+		for j := 0; j < bytesPerLimb && i*bytesPerLimb+j < len(data); j++ {
+			limbs[i] = api.Add(limbs[i], api.Mul(data[i*bytesPerLimb+j], new(big.Int).Lsh(big.NewInt(1), uint(8*j))))
+		}
+	}
+	return f.NewElement(limbs)
+}
+
+// bigIntFromLimb builds a BigInt from a native variable known to fit in a single limb.
+func bigIntFromLimb(f *emulated.Field[BigIntParams], v frontend.Variable) *BigInt {
+	var params BigIntParams
+	limbs := make([]frontend.Variable, params.NbLimbs())
+	limbs[0] = v
+	for i := 1; i < len(limbs); i++ {
+		limbs[i] = 0
+	}
+	return f.NewElement(limbs)
+}
+
+// bigIntConstant returns v with all limbs allocated, as expected by common_utils.ElementsLessEq.
+func bigIntConstant(v *big.Int) *BigInt {
+	ret := emulated.ValueOf[BigIntParams](v)
+	return &ret
+}
+
+// bigIntDivRem returns q, r such that a == q*b + r and r < b. The quotient is asserted to fit in
+// nbQuoLimbs limbs, the caller must make sure that q*b can not exceed the emulated modulus.
+func bigIntDivRem(api frontend.API, f *emulated.Field[BigIntParams], a, b *BigInt, nbQuoLimbs int) (*BigInt, *BigInt, error) {
+	res, err := f.NewHint(divHint, 2, a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, r := res[0], res[1]
+
+	for i := nbQuoLimbs; i < len(q.Limbs); i++ {
+		api.AssertIsEqual(q.Limbs[i], 0)
+	}
+	rPlus1 := f.Reduce(f.Add(r, f.One()))
+	api.AssertIsEqual(common_utils.ElementsLessEq(api, *rPlus1, *b), 1)
+
+	f.AssertIsEqual(f.Add(f.Mul(q, b), r), a)
+	return q, r, nil
+}
+
+// bigIntIsLessOrEqual returns 1 if a <= b, 0 otherwise.
+func bigIntIsLessOrEqual(api frontend.API, f *emulated.Field[BigIntParams], a, b *BigInt) frontend.Variable {
+	return common_utils.ElementsLessEq(api, *f.Reduce(a), *f.Reduce(b))
+}
@@ -0,0 +1,149 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+)
+
+// BlockHeaderBatchCircuit proves N consecutive headers at once. Its public layout is the one of
+// BlockHeaderUnitCircuit, so a batch ccs and vk fingerprint can take the place of the unit ones in
+// BlockHeaderRecursiveCircuit. All leaves of a recursive proof must then be batches of the same N.
+type BlockHeaderBatchCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT] struct {
+	BeginHash                 PublicHash            `gnark:",public"`
+	EndHash                   PublicHash            `gnark:",public"`
+	ChainWork                 frontend.Variable     `gnark:",public"`
+	BeginHeight               frontend.Variable     `gnark:",public"`
+	Count                     frontend.Variable     `gnark:",public"`
+	BeginState                ChainState            `gnark:",public"`
+	EndState                  ChainState            `gnark:",public"`
+	MMRRoot                   frontend.Variable     `gnark:",public"`
+	PlaceHolderForRecursiveFp utils.FingerPrint[FR] `gnark:",public"`
+	BlockHeaders              [][BlockHeaderLen]uints.U8
+
+	Network *Network `gnark:"-"`
+}
+
+func (c *BlockHeaderBatchCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.API) error {
+	n := len(c.BlockHeaders)
+	if n == 0 {
+		return fmt.Errorf("empty batch")
+	}
+
+	api.AssertIsEqual(c.Count, n)
+	rangecheck.New(api).Check(c.BeginHeight, HeightBits)
+	c.BeginState.AssertIsValid(api)
+
+	beginHash := c.BeginHash.Unpack(api, Hash(c.BlockHeaders[0][BeginHashOffset:BeginHashOffset+HashLen]))
+	hash := &beginHash
+	height := c.BeginHeight
+	state := c.BeginState
+	chainWork := frontend.Variable(0)
+	var peaks MMRPeaks
+	for i := 0; i < n; i++ {
+		var work frontend.Variable
+		var err error
+		hash, work, state, err = AssertBlockHeader(api, c.Network, *hash, height, state, c.BlockHeaders[i][:])
+		if err != nil {
+			return err
+		}
+		height = api.Add(height, 1)
+		chainWork = api.Add(chainWork, work)
+
+		leaf, err := MMRLeaf(api, *hash)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			peaks = SingleLeafMMR(leaf)
+		} else {
+			peaks, err = MergeMMR(api, i, peaks, 1, SingleLeafMMR(leaf))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	c.EndHash.AssertIsHash(api, *hash)
+	api.AssertIsEqual(chainWork, c.ChainWork)
+	state.AssertIsEqual(api, c.EndState)
+
+	mmrRoot, err := MMRRoot(api, n, peaks)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(mmrRoot, c.MMRRoot)
+	return nil
+}
+
+func NewBlockHeaderBatchCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](net *Network, n int, layout Layout) frontend.Circuit {
+	return &BlockHeaderBatchCircuit[FR, G1El, G2El, GtEl]{
+		BeginHash:    NewPublicHash(layout),
+		EndHash:      NewPublicHash(layout),
+		BlockHeaders: make([][BlockHeaderLen]uints.U8, n),
+		Network:      net,
+	}
+}
+
+func NewBlockHeaderBatchAssignment[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	net *Network,
+	blockHeaders [][BlockHeaderLen]byte,
+	beginHeight uint32,
+	beginState NativeChainState,
+	batchVkFpBytes utils.FingerPrintBytes,
+	layout Layout,
+) (frontend.Circuit, error) {
+	if len(blockHeaders) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+
+	beginHash := [HashLen]byte(blockHeaders[0][BeginHashOffset : BeginHashOffset+HashLen])
+	hash := chainhash.Hash(beginHash)
+	state := beginState
+	chainWork := big.NewInt(0)
+	mmr := NewMMR(nil)
+	_blockHeaders := make([][BlockHeaderLen]uints.U8, len(blockHeaders))
+	for i, header := range blockHeaders {
+		if chainhash.Hash(header[BeginHashOffset:BeginHashOffset+HashLen]) != hash {
+			return nil, fmt.Errorf("header %v does not build on %v", i, hash)
+		}
+
+		work, err := HeaderWork(header)
+		if err != nil {
+			return nil, err
+		}
+		chainWork.Add(chainWork, work)
+
+		state, err = state.Next(net, beginHeight+uint32(i)+1, header)
+		if err != nil {
+			return nil, err
+		}
+		hash = chainhash.DoubleHashH(header[:])
+		mmr.Append(hash)
+
+		for j := 0; j < BlockHeaderLen; j++ {
+			_blockHeaders[i][j] = uints.NewU8(header[j])
+		}
+	}
+
+	mmrRoot := mmr.Root()
+
+	return &BlockHeaderBatchCircuit[FR, G1El, G2El, GtEl]{
+		BeginHash:                 PublicHashOf(layout, beginHash),
+		EndHash:                   PublicHashOf(layout, hash),
+		ChainWork:                 chainWork,
+		BeginHeight:               beginHeight,
+		Count:                     len(blockHeaders),
+		BeginState:                ChainStateFromNative(beginState),
+		EndState:                  ChainStateFromNative(state),
+		MMRRoot:                   mmrRoot.BigInt(new(big.Int)),
+		PlaceHolderForRecursiveFp: utils.FingerPrintFromBytes[FR](batchVkFpBytes),
+		BlockHeaders:              _blockHeaders,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package circuits
+
+import (
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"github.com/lightec-xyz/common/operations"
+	"testing"
+)
+
+func TestBlockHeaderBatchCircuit_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, len(headers))
+	for i := range headers {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+	}
+	vkFpBytes := make([]byte, 32)
+
+	circuit := NewBlockHeaderBatchCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, len(blockHeaders), ByteLayout)
+	assignment, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, blockHeaders, 0, beginState, vkFpBytes, ByteLayout)
+	assert.NoError(err)
+
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//the batch must expose exactly the public layout of the unit circuit
+	batchCcs, err := operations.NewConstraintSystem(circuit)
+	assert.NoError(err)
+	unitCcs, err := operations.NewConstraintSystem(NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, ByteLayout))
+	assert.NoError(err)
+	assert.Equal(unitCcs.GetNbPublicVariables(), batchCcs.GetNbPublicVariables())
+
+	//headers must be consecutive
+	_, err = NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		MainNet, [][BlockHeaderLen]byte{blockHeaders[0], blockHeaders[2]}, 0, beginState, vkFpBytes, ByteLayout)
+	assert.Error(err)
+
+	bad := *(assignment.(*BlockHeaderBatchCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]))
+	bad.Count = len(blockHeaders) - 1
+	err = test.IsSolved(circuit, &bad, ecc.BN254.ScalarField())
+	assert.Error(err)
+}
@@ -0,0 +1,310 @@
+package circuits
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/hash/sha2"
+	"github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/recursion/plonk"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	native_sha3 "golang.org/x/crypto/sha3"
+	native_hash "hash"
+	"math/big"
+)
+
+// NbCommitmentPublicVariables is the number of public variables of the commitment circuit.
+const NbCommitmentPublicVariables = 1
+
+// CommitmentPreimageLen is the length of the bytes hashed into a commitment: BeginHash and EndHash
+// in internal order, ChainWork as 32 big endian bytes, BeginHeight and Count as 4, every field of
+// BeginState as 4 and the vk fingerprint as 32.
+const CommitmentPreimageLen = 2*HashLen + 32 + 4 + 4 + 4*ChainStateLen + 32
+
+// commitmentBits is the number of low bits of the hash kept in a commitment, so it fits the field.
+const commitmentBits = 253
+
+// CommitmentHash is the hash a commitment circuit commits to the public variables of a recursive
+// proof with.
+type CommitmentHash uint8
+
+const (
+	SHA256Commitment CommitmentHash = iota
+	Keccak256Commitment
+)
+
+// ParseCommitmentHash returns the hash named name, as printed by String.
+func ParseCommitmentHash(name string) (CommitmentHash, error) {
+	for _, h := range []CommitmentHash{SHA256Commitment, Keccak256Commitment} {
+		if h.String() == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown commitment hash %v, expected sha256 or keccak256", name)
+}
+
+func (h CommitmentHash) String() string {
+	switch h {
+	case SHA256Commitment:
+		return "sha256"
+	case Keccak256Commitment:
+		return "keccak256"
+	}
+	return fmt.Sprintf("CommitmentHash(%d)", uint8(h))
+}
+
+func (h CommitmentHash) native() (native_hash.Hash, error) {
+	switch h {
+	case SHA256Commitment:
+		return sha256.New(), nil
+	case Keccak256Commitment:
+		return native_sha3.NewLegacyKeccak256(), nil
+	}
+	return nil, fmt.Errorf("unknown commitment hash %v", h)
+}
+
+func (h CommitmentHash) inCircuit(api frontend.API) (hash.BinaryHasher, error) {
+	switch h {
+	case SHA256Commitment:
+		return sha2.New(api)
+	case Keccak256Commitment:
+		return sha3.NewLegacyKeccak256(api)
+	}
+	return nil, fmt.Errorf("unknown commitment hash %v", h)
+}
+
+// CommitmentPreimage returns the bytes hashed into the commitment of public, CommitmentPreimageLen
+// of them laid out as
+//
+//	BeginHash (32) || EndHash (32) || ChainWork (32) || BeginHeight (4) || Count (4) ||
+//	BeginState: EpochBits (4) || EpochStartTime (4) || Bits (4) || Timestamps (11*4) || VkFp (32)
+//
+// with the hashes in internal byte order and the numbers big endian.
+func CommitmentPreimage(public *PublicWitness) ([]byte, error) {
+	if public.ChainWork.BitLen() > 256 || len(public.VkFp) != 32 {
+		return nil, fmt.Errorf("chain work or vk fingerprint exceeds 32 bytes")
+	}
+	preimage := make([]byte, 0, CommitmentPreimageLen)
+	preimage = append(preimage, public.BeginHash[:]...)
+	preimage = append(preimage, public.EndHash[:]...)
+	preimage = append(preimage, public.ChainWork.FillBytes(make([]byte, 32))...)
+	preimage = binary.BigEndian.AppendUint32(preimage, public.BeginHeight)
+	preimage = binary.BigEndian.AppendUint32(preimage, public.Count)
+	state := public.BeginState
+	for _, v := range append([]uint32{state.EpochBits, state.EpochStartTime, state.Bits}, state.Timestamps[:]...) {
+		preimage = binary.BigEndian.AppendUint32(preimage, v)
+	}
+	preimage = append(preimage, public.VkFp...)
+	return preimage, nil
+}
+
+// Commitment returns the commitment of public with h, the hash of CommitmentPreimage read as a big
+// endian number with its top 3 bits cleared. On chain that is
+//
+//	uint256(keccak256(abi.encodePacked(beginHash, endHash, chainWork, beginHeight, count,
+//		epochBits, epochStartTime, bits, timestamp0, ..., timestamp10, vkFp))) & ((1 << 253) - 1)
+//
+// with beginHeight, count, the fields of the begin state and every timestamp an uint32 and the
+// others bytes32 or uint256. The begin height and state are committed to as the verifier must
+// check them, the chain state a range builds on is not proven.
+func Commitment(h CommitmentHash, public *PublicWitness) (*big.Int, error) {
+	preimage, err := CommitmentPreimage(public)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := h.native()
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(preimage)
+	sum := new(big.Int).SetBytes(hasher.Sum(nil))
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), commitmentBits), big.NewInt(1))
+	return sum.And(sum, mask), nil
+}
+
+// BlockHeaderCommitmentCircuit wraps a proof of the recursive circuit, in either layout, into a
+// proof with the only public variable Commitment, the commitment of its public variables.
+type BlockHeaderCommitmentCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT] struct {
+	Commitment frontend.Variable `gnark:",public"`
+
+	RecursiveVk      plonk.VerifyingKey[FR, G1El, G2El]
+	RecursiveProof   plonk.Proof[FR, G1El, G2El]
+	RecursiveWitness plonk.Witness[FR]
+
+	RecursiveVkFpBytes utils.FingerPrintBytes
+	Hash               CommitmentHash `gnark:"-"`
+}
+
+func (c *BlockHeaderCommitmentCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.API) error {
+	layout, err := assertRecursiveProof[FR, G1El, G2El, GtEl](api, c.RecursiveVk, c.RecursiveProof, c.RecursiveWitness, c.RecursiveVkFpBytes)
+	if err != nil {
+		return err
+	}
+	public := c.RecursiveWitness.Public
+	witnessVkFp := RetrieveU254ValueFromElement[FR](api, public[layout.VkFpIndex()])
+
+	//the preimage as CommitmentPreimage lays it out
+	preimage := make([]uints.U8, 0, CommitmentPreimageLen)
+	for _, index := range []int{layout.BeginHashIndex(), layout.EndHashIndex()} {
+		h := PublicHashFromWitness[FR](api, layout, public[index:])
+		for i := range h {
+			preimage = append(preimage, bytesOf(api, h[i], HashLen/len(h))...)
+		}
+	}
+	chainWork := RetrieveU254ValueFromElement[FR](api, public[layout.ChainWorkIndex()])
+	preimage = append(preimage, bytesOf(api, chainWork, 32)...)
+	for _, index := range []int{layout.BeginHeightIndex(), layout.CountIndex()} {
+		v := RetrieveU254ValueFromElement[FR](api, public[index])
+		preimage = append(preimage, bytesOf(api, v, 4)...)
+	}
+	state := ChainStateFromWitness[FR](api, public[layout.BeginStateIndex():])
+	for _, v := range append([]frontend.Variable{state.EpochBits, state.EpochStartTime, state.Bits}, state.Timestamps[:]...) {
+		preimage = append(preimage, bytesOf(api, v, 4)...)
+	}
+	preimage = append(preimage, bytesOf(api, witnessVkFp, 32)...)
+
+	hasher, err := c.Hash.inCircuit(api)
+	if err != nil {
+		return err
+	}
+	hasher.Write(preimage)
+	sum := hasher.Sum()
+
+	//the top 3 bits of the hash are dropped
+	top := api.ToBinary(sum[0].Val, 8)
+	commitment := api.FromBinary(top[:commitmentBits%8]...)
+	for _, b := range sum[1:] {
+		commitment = api.Add(api.Mul(commitment, 256), b.Val)
+	}
+	api.AssertIsEqual(c.Commitment, commitment)
+	return nil
+}
+
+// assertRecursiveProof asserts that proof verifies for vk, and that both vk and the public witness
+// carry the fingerprint recursiveVkFpBytes: only a proof of the recursive circuit vouches for a
+// header chain. It returns the layout of the witness.
+func assertRecursiveProof[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	api frontend.API,
+	vk plonk.VerifyingKey[FR, G1El, G2El],
+	proof plonk.Proof[FR, G1El, G2El],
+	wit plonk.Witness[FR],
+	recursiveVkFpBytes utils.FingerPrintBytes,
+) (Layout, error) {
+	layout, err := LayoutOf(len(wit.Public))
+	if err != nil {
+		return layout, err
+	}
+
+	recursiveVkFp := utils.FingerPrintFromBytes[FR](recursiveVkFpBytes)
+	vkFp, err := utils.InCircuitFingerPrint[FR, G1El, G2El](api, &vk)
+	if err != nil {
+		return layout, err
+	}
+	api.AssertIsEqual(vkFp, recursiveVkFp.Val)
+	witnessVkFp := RetrieveU254ValueFromElement[FR](api, wit.Public[layout.VkFpIndex()])
+	api.AssertIsEqual(witnessVkFp, recursiveVkFp.Val)
+
+	verifier, err := plonk.NewVerifier[FR, G1El, G2El, GtEl](api)
+	if err != nil {
+		return layout, err
+	}
+	err = verifier.AssertProof(vk, proof, wit, plonk.WithCompleteArithmetic())
+	return layout, err
+}
+
+// bytesOf returns v as nbBytes big endian bytes and asserts it fits in them. A value as wide as the
+// field is decomposed canonically, so no two preimages commit to the same public variables.
+func bytesOf(api frontend.API, v frontend.Variable, nbBytes int) []uints.U8 {
+	nbBits := min(8*nbBytes, api.Compiler().FieldBitLen())
+	bits := api.ToBinary(v, nbBits)
+
+	ret := make([]uints.U8, nbBytes)
+	for i := range ret {
+		//the i-th byte holds bits 8*(nbBytes-1-i) and up
+		low := 8 * (nbBytes - 1 - i)
+		b := frontend.Variable(0)
+		for j := min(low+8, nbBits) - 1; j >= low; j-- {
+			b = api.Add(api.Mul(b, 2), bits[j])
+		}
+		ret[i] = uints.U8{Val: b}
+	}
+	return ret
+}
+
+// NewBlockHeaderCommitmentCircuit builds the commitment circuit over proofs of the recursive
+// circuit recursiveCcs, whose vk has the fingerprint recursiveVkFpBytes.
+func NewBlockHeaderCommitmentCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	recursiveCcs constraint.ConstraintSystem,
+	recursiveVkFpBytes utils.FingerPrintBytes,
+	h CommitmentHash,
+) frontend.Circuit {
+	return &BlockHeaderCommitmentCircuit[FR, G1El, G2El, GtEl]{
+		RecursiveVk:        plonk.PlaceholderVerifyingKey[FR, G1El, G2El](recursiveCcs),
+		RecursiveProof:     plonk.PlaceholderProof[FR, G1El, G2El](recursiveCcs),
+		RecursiveWitness:   plonk.PlaceholderWitness[FR](recursiveCcs),
+		RecursiveVkFpBytes: recursiveVkFpBytes,
+		Hash:               h,
+	}
+}
+
+func NewBlockHeaderCommitmentAssignment[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	recursiveVk native_plonk.VerifyingKey,
+	recursiveProof native_plonk.Proof,
+	recursiveWitness witness.Witness,
+	h CommitmentHash,
+) (frontend.Circuit, error) {
+	public, err := DecodePublicWitness(recursiveWitness)
+	if err != nil {
+		return nil, err
+	}
+	commitment, err := Commitment(h, public)
+	if err != nil {
+		return nil, err
+	}
+
+	_vk, err := plonk.ValueOfVerifyingKey[FR, G1El, G2El](recursiveVk)
+	if err != nil {
+		return nil, err
+	}
+	_proof, err := plonk.ValueOfProof[FR, G1El, G2El](recursiveProof)
+	if err != nil {
+		return nil, err
+	}
+	_witness, err := plonk.ValueOfWitness[FR](recursiveWitness)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockHeaderCommitmentCircuit[FR, G1El, G2El, GtEl]{
+		Commitment:       commitment,
+		RecursiveVk:      _vk,
+		RecursiveProof:   _proof,
+		RecursiveWitness: _witness,
+		Hash:             h,
+	}, nil
+}
+
+// CommitmentOf returns the commitment exposed by a witness of the commitment circuit.
+func CommitmentOf(wit witness.Witness) (*big.Int, error) {
+	public, err := wit.Public()
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := public.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("witness is not over bn254")
+	}
+	if len(vec) != NbCommitmentPublicVariables {
+		return nil, fmt.Errorf("%v public variables, expected %v", len(vec), NbCommitmentPublicVariables)
+	}
+	return vec[0].BigInt(new(big.Int)), nil
+}
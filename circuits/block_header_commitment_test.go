@@ -0,0 +1,170 @@
+package circuits
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCommitment(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	public := &PublicWitness{
+		ChainWork:   big.NewInt(0x0200020002),
+		BeginHeight: 7,
+		Count:       2,
+		BeginState:  beginState,
+		VkFp:        make([]byte, 32),
+	}
+	public.BeginHash[0] = 1
+	public.EndHash[31] = 2
+	public.VkFp[31] = 3
+	public.BeginState.Timestamps[MedianTimeSpan-1] = 0x01020304
+
+	preimage, err := CommitmentPreimage(public)
+	assert.NoError(err)
+	assert.Equal(CommitmentPreimageLen, len(preimage))
+	expected := "01" + strings.Repeat("00", 31) + //begin hash
+		strings.Repeat("00", 31) + "02" + //end hash
+		strings.Repeat("00", 27) + "0200020002" + //chain work
+		"00000007" + //begin height
+		"00000002" + //count
+		"1d00ffff" + "495fab29" + "1d00ffff" + //epoch bits, epoch start time, bits
+		strings.Repeat("495fab29", MedianTimeSpan-1) + "01020304" + //timestamps
+		strings.Repeat("00", 31) + "03" //vk fingerprint
+	assert.Equal(expected, hex.EncodeToString(preimage))
+
+	//the commitment changes with the state the range builds on
+	sum0, err := Commitment(SHA256Commitment, public)
+	assert.NoError(err)
+	public.BeginState.EpochBits++
+	sum1, err := Commitment(SHA256Commitment, public)
+	assert.NoError(err)
+	assert.NotEqual(sum0, sum1)
+	public.BeginState.EpochBits--
+
+	sum := sha256.Sum256(preimage)
+	sum[0] &= 0x1f
+	commitment, err := Commitment(SHA256Commitment, public)
+	assert.NoError(err)
+	assert.Equal(new(big.Int).SetBytes(sum[:]), commitment)
+
+	keccak, err := Commitment(Keccak256Commitment, public)
+	assert.NoError(err)
+	assert.True(keccak.BitLen() <= commitmentBits)
+	assert.NotEqual(commitment, keccak)
+
+	for _, h := range []CommitmentHash{SHA256Commitment, Keccak256Commitment} {
+		parsed, err := ParseCommitmentHash(h.String())
+		assert.NoError(err)
+		assert.Equal(h, parsed)
+	}
+	_, err = ParseCommitmentHash("mimc")
+	assert.Error(err)
+}
+
+// fakeRecursiveCircuit has the public layout of the recursive circuit and proves nothing about it.
+type fakeRecursiveCircuit struct {
+	Public []frontend.Variable `gnark:",public"`
+	Out    frontend.Variable
+}
+
+func (c *fakeRecursiveCircuit) Define(api frontend.API) error {
+	square := api.Mul(c.Public[0], c.Public[0])
+	api.AssertIsEqual(api.Add(square, c.Public[1], 3), c.Out)
+	return nil
+}
+
+// proveFakeRecursive sets up fakeRecursiveCircuit in layout and proves it over the public witness
+// of blockHeaders, carrying the fingerprint of its own vk if ownVkFp is set and zero otherwise.
+func proveFakeRecursive(assert *test.Assert, blockHeaders [][BlockHeaderLen]byte, layout Layout, ownVkFp bool) (constraint.ConstraintSystem, native_plonk.VerifyingKey, utils.FingerPrintBytes, native_plonk.Proof, witness.Witness) {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &fakeRecursiveCircuit{Public: make([]frontend.Variable, layout.NbPublicVariables())})
+	assert.NoError(err)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	pk, vk, err := native_plonk.Setup(ccs, srs, lsrs)
+	assert.NoError(err)
+	vkFp, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	assert.NoError(err)
+
+	witnessVkFp := make([]byte, 32)
+	if ownVkFp {
+		witnessVkFp = vkFp
+	}
+	batch, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, blockHeaders, 0, beginState, witnessVkFp, layout)
+	assert.NoError(err)
+	public, err := frontend.NewWitness(batch, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	assert.NoError(err)
+	vec := public.Vector().(fr.Vector)
+
+	inner := &fakeRecursiveCircuit{Public: make([]frontend.Variable, len(vec))}
+	for i := range vec {
+		inner.Public[i] = vec[i]
+	}
+	var out fr.Element
+	out.Square(&vec[0]).Add(&out, &vec[1]).Add(&out, new(fr.Element).SetUint64(3))
+	inner.Out = out
+	proof, wit, err := operations.PlonkProve(ccs, pk, inner, false)
+	assert.NoError(err)
+	return ccs, vk, vkFp, proof, wit
+}
+
+func TestBlockHeaderCommitmentCircuit_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, 2)
+	for i := range blockHeaders {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+	}
+
+	for _, tc := range []struct {
+		layout Layout
+		hash   CommitmentHash
+	}{
+		{ByteLayout, SHA256Commitment},
+		{PackedLayout, Keccak256Commitment},
+	} {
+		ccs, vk, vkFp, proof, wit := proveFakeRecursive(assert, blockHeaders, tc.layout, true)
+
+		circuit := NewBlockHeaderCommitmentCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](ccs, vkFp, tc.hash)
+		assignment, err := NewBlockHeaderCommitmentAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk, proof, wit, tc.hash)
+		assert.NoError(err)
+		err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+		assert.NoError(err)
+
+		//the commitment must be the one of the public variables
+		decoded, err := DecodePublicWitness(wit)
+		assert.NoError(err)
+		decoded.Count++
+		wrong, err := Commitment(tc.hash, decoded)
+		assert.NoError(err)
+		bad := *(assignment.(*BlockHeaderCommitmentCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]))
+		bad.Commitment = wrong
+		err = test.IsSolved(circuit, &bad, ecc.BN254.ScalarField())
+		assert.Error(err)
+	}
+
+	//a proof not carrying the fingerprint of its vk does not commit
+	ccs, vk, vkFp, proof, wit := proveFakeRecursive(assert, blockHeaders, ByteLayout, false)
+	circuit := NewBlockHeaderCommitmentCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](ccs, vkFp, SHA256Commitment)
+	assignment, err := NewBlockHeaderCommitmentAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk, proof, wit, SHA256Commitment)
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.Error(err)
+}
@@ -0,0 +1,97 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/recursion/plonk"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+)
+
+// BlockHeaderGroth16Circuit verifies a proof of the recursive circuit, to be proven with Groth16,
+// whose proofs are smaller and cheaper to verify on chain. Public holds the public variables of the
+// recursive proof in its layout, so its witness decodes with DecodePublicWitness too.
+type BlockHeaderGroth16Circuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT] struct {
+	Public []frontend.Variable `gnark:",public"`
+
+	RecursiveVk      plonk.VerifyingKey[FR, G1El, G2El]
+	RecursiveProof   plonk.Proof[FR, G1El, G2El]
+	RecursiveWitness plonk.Witness[FR]
+
+	RecursiveVkFpBytes utils.FingerPrintBytes
+}
+
+func (c *BlockHeaderGroth16Circuit[FR, G1El, G2El, GtEl]) Define(api frontend.API) error {
+	if len(c.Public) != len(c.RecursiveWitness.Public) {
+		return fmt.Errorf("%v public variables, the recursive proof has %v", len(c.Public), len(c.RecursiveWitness.Public))
+	}
+	_, err := assertRecursiveProof[FR, G1El, G2El, GtEl](api, c.RecursiveVk, c.RecursiveProof, c.RecursiveWitness, c.RecursiveVkFpBytes)
+	if err != nil {
+		return err
+	}
+
+	for i := range c.Public {
+		api.AssertIsEqual(c.Public[i], RetrieveU254ValueFromElement[FR](api, c.RecursiveWitness.Public[i]))
+	}
+	return nil
+}
+
+// NewBlockHeaderGroth16Circuit builds the Groth16 circuit over proofs of the recursive circuit
+// recursiveCcs, whose vk has the fingerprint recursiveVkFpBytes.
+func NewBlockHeaderGroth16Circuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	recursiveCcs constraint.ConstraintSystem,
+	recursiveVkFpBytes utils.FingerPrintBytes,
+) frontend.Circuit {
+	return &BlockHeaderGroth16Circuit[FR, G1El, G2El, GtEl]{
+		Public:             make([]frontend.Variable, recursiveCcs.GetNbPublicVariables()),
+		RecursiveVk:        plonk.PlaceholderVerifyingKey[FR, G1El, G2El](recursiveCcs),
+		RecursiveProof:     plonk.PlaceholderProof[FR, G1El, G2El](recursiveCcs),
+		RecursiveWitness:   plonk.PlaceholderWitness[FR](recursiveCcs),
+		RecursiveVkFpBytes: recursiveVkFpBytes,
+	}
+}
+
+func NewBlockHeaderGroth16Assignment[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	recursiveVk native_plonk.VerifyingKey,
+	recursiveProof native_plonk.Proof,
+	recursiveWitness witness.Witness,
+) (frontend.Circuit, error) {
+	public, err := recursiveWitness.Public()
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := public.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("witness is not over bn254")
+	}
+	_public := make([]frontend.Variable, len(vec))
+	for i := range vec {
+		_public[i] = vec[i].BigInt(new(big.Int))
+	}
+
+	_vk, err := plonk.ValueOfVerifyingKey[FR, G1El, G2El](recursiveVk)
+	if err != nil {
+		return nil, err
+	}
+	_proof, err := plonk.ValueOfProof[FR, G1El, G2El](recursiveProof)
+	if err != nil {
+		return nil, err
+	}
+	_witness, err := plonk.ValueOfWitness[FR](recursiveWitness)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockHeaderGroth16Circuit[FR, G1El, G2El, GtEl]{
+		Public:           _public,
+		RecursiveVk:      _vk,
+		RecursiveProof:   _proof,
+		RecursiveWitness: _witness,
+	}, nil
+}
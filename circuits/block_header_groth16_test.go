@@ -0,0 +1,51 @@
+package circuits
+
+import (
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"testing"
+)
+
+func TestBlockHeaderGroth16Circuit_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, 2)
+	for i := range blockHeaders {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+	}
+
+	ccs, vk, vkFp, proof, wit := proveFakeRecursive(assert, blockHeaders, PackedLayout, true)
+	circuit := NewBlockHeaderGroth16Circuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](ccs, vkFp)
+	assignment, err := NewBlockHeaderGroth16Assignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk, proof, wit)
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//the public witness is that of the recursive proof
+	public, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	assert.NoError(err)
+	decoded, err := DecodePublicWitness(public)
+	assert.NoError(err)
+	expected, err := DecodePublicWitness(wit)
+	assert.NoError(err)
+	assert.Equal(expected, decoded)
+
+	bad := *(assignment.(*BlockHeaderGroth16Circuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]))
+	bad.Public = append([]frontend.Variable{}, bad.Public...)
+	bad.Public[PackedLayout.CountIndex()] = 3
+	err = test.IsSolved(circuit, &bad, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//a proof not carrying the fingerprint of its vk is not wrapped
+	ccs, vk, vkFp, proof, wit = proveFakeRecursive(assert, blockHeaders, ByteLayout, false)
+	circuit = NewBlockHeaderGroth16Circuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](ccs, vkFp)
+	assignment, err = NewBlockHeaderGroth16Assignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk, proof, wit)
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.Error(err)
+}
@@ -1,13 +1,13 @@
 package circuits
 
 import (
+	"fmt"
 	native_plonk "github.com/consensys/gnark/backend/plonk"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra"
 	"github.com/consensys/gnark/std/math/emulated"
-	"github.com/consensys/gnark/std/math/uints"
 	"github.com/consensys/gnark/std/rangecheck"
 	"github.com/consensys/gnark/std/recursion/plonk"
 	"github.com/readygo67/BlockHeaderProver/utils"
@@ -15,9 +15,20 @@ import (
 )
 
 type BlockHeaderRecursiveCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT] struct {
-	BeginHash Hash `gnark:",public"`
-	RelayHash Hash
-	EndHash   Hash `gnark:",public"`
+	BeginHash PublicHash `gnark:",public"`
+	RelayHash PublicHash
+	EndHash   PublicHash `gnark:",public"`
+
+	ChainWork   frontend.Variable `gnark:",public"`
+	BeginHeight frontend.Variable `gnark:",public"`
+	Count       frontend.Variable `gnark:",public"`
+	BeginState  ChainState        `gnark:",public"`
+	EndState    ChainState        `gnark:",public"`
+	MMRRoot     frontend.Variable `gnark:",public"`
+
+	//peaks of the MMRs of the two children
+	FirstPeaks  MMRPeaks
+	SecondPeaks MMRPeaks
 
 	FirstVk      plonk.VerifyingKey[FR, G1El, G2El]
 	FirstProof   plonk.Proof[FR, G1El, G2El]
@@ -32,6 +43,15 @@ type BlockHeaderRecursiveCircuit[FR emulated.FieldParams, G1El algebra.G1Element
 }
 
 func (c *BlockHeaderRecursiveCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.API) error {
+	//the children are in the layout of the leaves, and so is this circuit
+	layout, err := LayoutOf(len(c.FirstWitness.Public))
+	if err != nil {
+		return err
+	}
+	if len(c.BeginHash) != layout.HashLen() {
+		return fmt.Errorf("hashes of %v variables in the %v layout", len(c.BeginHash), layout)
+	}
+
 	// check fingerprints
 	{
 		uintVkFp := utils.FingerPrintFromBytes[FR](c.UnitVkFpBytes)
@@ -39,19 +59,24 @@ func (c *BlockHeaderRecursiveCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.
 		if err != nil {
 			return err
 		}
-		vkFpInFirstWitness := RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[64])
+		vkFpInFirstWitness := RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[layout.VkFpIndex()])
 		api.AssertIsEqual(firstVkFp, vkFpInFirstWitness) //check the first
 
 		isFirstVkRecursive := api.IsZero(api.Sub(firstVkFp, c.RecursiveVkFp.Val))
 		isFirstVkUnit := api.IsZero(api.Sub(firstVkFp, uintVkFp.Val))
-		api.Println("is first vk recursive", isFirstVkRecursive)
-		api.Println("is first vk unit", isFirstVkUnit)
 		api.AssertIsEqual(api.Add(isFirstVkRecursive, isFirstVkUnit), 1) //firstVk must be one of {recursive, unit}
 
-		//second vk must be unit
+		//both children may be recursive, so ranges can be merged as a binary tree
 		secondVkFp, err := utils.InCircuitFingerPrint[FR, G1El, G2El](api, &c.SecondVk)
+		if err != nil {
+			return err
+		}
+		vkFpInSecondWitness := RetrieveU254ValueFromElement[FR](api, c.SecondWitness.Public[layout.VkFpIndex()])
+		api.AssertIsEqual(secondVkFp, vkFpInSecondWitness) //check the second
+
+		isSecondVkRecursive := api.IsZero(api.Sub(secondVkFp, c.RecursiveVkFp.Val))
 		isSecondVkUnit := api.IsZero(api.Sub(secondVkFp, uintVkFp.Val))
-		api.AssertIsEqual(isSecondVkUnit, 1)
+		api.AssertIsEqual(api.Add(isSecondVkRecursive, isSecondVkUnit), 1) //secondVk must be one of {recursive, unit}
 	}
 
 	//check proofs
@@ -75,30 +100,83 @@ func (c *BlockHeaderRecursiveCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.
 	//check relation
 	{
 		//c.BeginHash == firstWitness.BeginHash
-		for i := 0; i < HashLen; i++ {
-			api.AssertIsEqual(c.BeginHash[i].Val, c.FirstWitness.Public[i].Limbs[0])
-		}
+		c.BeginHash.AssertIsEqual(api, PublicHashFromWitness[FR](api, layout, c.FirstWitness.Public[layout.BeginHashIndex():]))
 
 		//c.RelayHash == firstWitness.EndHash == secondWitness.BeginHash
-		for i := 0; i < HashLen; i++ {
-			api.AssertIsEqual(c.RelayHash[i].Val, c.FirstWitness.Public[HashLen+i].Limbs[0])
-			api.AssertIsEqual(c.RelayHash[i].Val, c.SecondWitness.Public[i].Limbs[0])
+		firstEndHash := PublicHashFromWitness[FR](api, layout, c.FirstWitness.Public[layout.EndHashIndex():])
+		secondBeginHash := PublicHashFromWitness[FR](api, layout, c.SecondWitness.Public[layout.BeginHashIndex():])
+		for i := range c.RelayHash {
+			api.AssertIsEqual(c.RelayHash[i], firstEndHash[i])
+			api.AssertIsEqual(c.RelayHash[i], secondBeginHash[i])
 		}
 
 		//c.EndHash == secondWitness.EndHash
-		for i := 0; i < HashLen; i++ {
-			api.AssertIsEqual(c.EndHash[i].Val, c.SecondWitness.Public[HashLen+i].Limbs[0])
+		c.EndHash.AssertIsEqual(api, PublicHashFromWitness[FR](api, layout, c.SecondWitness.Public[layout.EndHashIndex():]))
+
+		//c.ChainWork == firstWitness.ChainWork + secondWitness.ChainWork
+		firstChainWork := RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[layout.ChainWorkIndex()])
+		secondChainWork := RetrieveU254ValueFromElement[FR](api, c.SecondWitness.Public[layout.ChainWorkIndex()])
+		api.AssertIsEqual(c.ChainWork, api.Add(firstChainWork, secondChainWork))
+
+		//c.BeginHeight == firstWitness.BeginHeight
+		//secondWitness.BeginHeight == firstWitness.BeginHeight + firstWitness.Count
+		//c.Count == firstWitness.Count + secondWitness.Count
+		firstBeginHeight := RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[layout.BeginHeightIndex()])
+		firstCount := RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[layout.CountIndex()])
+		secondBeginHeight := RetrieveU254ValueFromElement[FR](api, c.SecondWitness.Public[layout.BeginHeightIndex()])
+		secondCount := RetrieveU254ValueFromElement[FR](api, c.SecondWitness.Public[layout.CountIndex()])
+		api.AssertIsEqual(c.BeginHeight, firstBeginHeight)
+		api.AssertIsEqual(secondBeginHeight, api.Add(firstBeginHeight, firstCount))
+		api.AssertIsEqual(c.Count, api.Add(firstCount, secondCount))
+
+		//c.BeginState == firstWitness.BeginState
+		//firstWitness.EndState == secondWitness.BeginState
+		//c.EndState == secondWitness.EndState
+		ChainStateFromWitness[FR](api, c.FirstWitness.Public[layout.BeginStateIndex():]).AssertIsEqual(api, c.BeginState)
+		ChainStateFromWitness[FR](api, c.FirstWitness.Public[layout.EndStateIndex():]).AssertIsEqual(api, ChainStateFromWitness[FR](api, c.SecondWitness.Public[layout.BeginStateIndex():]))
+		ChainStateFromWitness[FR](api, c.SecondWitness.Public[layout.EndStateIndex():]).AssertIsEqual(api, c.EndState)
+
+		//c.MMRRoot accumulates the leaves of firstWitness.MMRRoot followed by those of secondWitness.MMRRoot
+		firstRoot, err := MMRRoot(api, firstCount, c.FirstPeaks)
+		if err != nil {
+			return err
 		}
+		api.AssertIsEqual(firstRoot, RetrieveU254ValueFromElement[FR](api, c.FirstWitness.Public[layout.MMRRootIndex()]))
+
+		secondRoot, err := MMRRoot(api, secondCount, c.SecondPeaks)
+		if err != nil {
+			return err
+		}
+		api.AssertIsEqual(secondRoot, RetrieveU254ValueFromElement[FR](api, c.SecondWitness.Public[layout.MMRRootIndex()]))
+
+		peaks, err := MergeMMR(api, firstCount, c.FirstPeaks, secondCount, c.SecondPeaks)
+		if err != nil {
+			return err
+		}
+		root, err := MMRRoot(api, c.Count, peaks)
+		if err != nil {
+			return err
+		}
+		api.AssertIsEqual(root, c.MMRRoot)
 	}
 
 	return nil
 }
 
+// NewBlockHeaderRecursiveCircuit builds the recursive circuit over leaves proven by unitCcs, which
+// may be the ccs of either BlockHeaderUnitCircuit or a BlockHeaderBatchCircuit, in the layout of
+// unitCcs.
 func NewBlockHeaderRecursiveCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
 	unitCcs constraint.ConstraintSystem,
 	unitVkFpBytes utils.FingerPrintBytes,
 ) frontend.Circuit {
+	//an unknown layout is reported by Define
+	layout, _ := LayoutOf(unitCcs.GetNbPublicVariables())
 	return &BlockHeaderRecursiveCircuit[FR, G1El, G2El, GtEl]{
+		BeginHash: NewPublicHash(layout),
+		RelayHash: NewPublicHash(layout),
+		EndHash:   NewPublicHash(layout),
+
 		FirstVk:      plonk.PlaceholderVerifyingKey[FR, G1El, G2El](unitCcs),
 		FirstProof:   plonk.PlaceholderProof[FR, G1El, G2El](unitCcs),
 		FirstWitness: plonk.PlaceholderWitness[FR](unitCcs),
@@ -120,6 +198,12 @@ func NewBlockHeaderRecursiveAssignment[FR emulated.FieldParams, G1El algebra.G1E
 	beginHash [HashLen]byte,
 	relayHash [HashLen]byte,
 	endHash [HashLen]byte,
+	chainWork *big.Int,
+	beginHeight uint32,
+	count uint32,
+	beginState NativeChainState,
+	endState NativeChainState,
+	firstMMR, secondMMR *MMR,
 ) (frontend.Circuit, error) {
 	_firstVk, err := plonk.ValueOfVerifyingKey[FR, G1El, G2El](firstVk)
 	if err != nil {
@@ -147,24 +231,35 @@ func NewBlockHeaderRecursiveAssignment[FR emulated.FieldParams, G1El algebra.G1E
 	if err != nil {
 		return nil, err
 	}
-
-	_beginHash := Hash{}
-	for i := 0; i < HashLen; i++ {
-		_beginHash[i] = uints.NewU8(beginHash[i])
+	layout, err := LayoutOf(len(_firstWitness.Public))
+	if err != nil {
+		return nil, err
 	}
-	_relayHash := Hash{}
-	for i := 0; i < HashLen; i++ {
-		_relayHash[i] = uints.NewU8(relayHash[i])
+
+	mmr, err := firstMMR.Merge(secondMMR)
+	if err != nil {
+		return nil, err
 	}
-	_endHash := Hash{}
-	for i := 0; i < HashLen; i++ {
-		_endHash[i] = uints.NewU8(endHash[i])
+	mmrRoot := mmr.Root()
+	firstPeaks, secondPeaks := firstMMR.Peaks(), secondMMR.Peaks()
+	var _firstPeaks, _secondPeaks MMRPeaks
+	for h := 0; h < MMRMaxHeight; h++ {
+		_firstPeaks[h] = firstPeaks[h].BigInt(new(big.Int))
+		_secondPeaks[h] = secondPeaks[h].BigInt(new(big.Int))
 	}
 
 	return &BlockHeaderRecursiveCircuit[FR, G1El, G2El, GtEl]{
-		BeginHash:     _beginHash,
-		RelayHash:     _relayHash,
-		EndHash:       _endHash,
+		BeginHash:     PublicHashOf(layout, beginHash),
+		RelayHash:     PublicHashOf(layout, relayHash),
+		EndHash:       PublicHashOf(layout, endHash),
+		ChainWork:     chainWork,
+		BeginHeight:   beginHeight,
+		Count:         count,
+		BeginState:    ChainStateFromNative(beginState),
+		EndState:      ChainStateFromNative(endState),
+		MMRRoot:       mmrRoot.BigInt(new(big.Int)),
+		FirstPeaks:    _firstPeaks,
+		SecondPeaks:   _secondPeaks,
 		FirstVk:       _firstVk,
 		FirstProof:    _firstProof,
 		FirstWitness:  _firstWitness,
@@ -9,9 +9,33 @@ import (
 	"github.com/consensys/gnark/test"
 	"github.com/lightec-xyz/common/operations"
 	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
 	"testing"
 )
 
+func chainWork(headers [][]byte) *big.Int {
+	sum := big.NewInt(0)
+	for _, header := range headers {
+		work, err := HeaderWork([80]byte(header))
+		if err != nil {
+			panic(err)
+		}
+		sum.Add(sum, work)
+	}
+	return sum
+}
+
+func chainState(state NativeChainState, beginHeight uint32, headers [][]byte) NativeChainState {
+	for i, header := range headers {
+		var err error
+		state, err = state.Next(MainNet, beginHeight+uint32(i)+1, [80]byte(header))
+		if err != nil {
+			panic(err)
+		}
+	}
+	return state
+}
+
 func TestBlockHeaderRecursiveCircuit_Recursive_Setup(t *testing.T) {
 	assert := test.NewAssert(t)
 
@@ -107,7 +131,14 @@ func TestBlockHeaderRecursiveCircuit_Recursive_0_2_Simulation(t *testing.T) {
 		beignHash,
 		hashes[0],
 		hashes[1],
+		chainWork(_headers[:2]),
+		0,
+		2,
+		beginState,
+		chainState(beginState, 0, _headers[:2]),
+		NewMMR(hashes[:1]), NewMMR(hashes[1:2]),
 	)
+	assert.NoError(err)
 
 	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
 	assert.NoError(err)
@@ -161,7 +192,14 @@ func TestBlockHeaderRecursiveCircuit_Recursive_0_2_Plonk(t *testing.T) {
 		beignHash,
 		hashes[0],
 		hashes[1],
+		chainWork(_headers[:2]),
+		0,
+		2,
+		beginState,
+		chainState(beginState, 0, _headers[:2]),
+		NewMMR(hashes[:1]), NewMMR(hashes[1:2]),
 	)
+	assert.NoError(err)
 
 	recursiveCcs, err := operations.ReadCcs(recursiveCcsFile)
 	assert.NoError(err)
@@ -245,7 +283,14 @@ func TestBlockHeaderRecursiveCircuit_Recursive_0_3_Simulation(t *testing.T) {
 		beignHash,
 		hashes[1],
 		hashes[2],
+		chainWork(_headers[:3]),
+		0,
+		3,
+		beginState,
+		chainState(beginState, 0, _headers[:3]),
+		NewMMR(hashes[:2]), NewMMR(hashes[2:3]),
 	)
+	assert.NoError(err)
 
 	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
 	assert.NoError(err)
@@ -299,7 +344,14 @@ func TestBlockHeaderRecursiveCircuit_Recursive_0_3_Plonk(t *testing.T) {
 		beignHash,
 		hashes[1],
 		hashes[2],
+		chainWork(_headers[:3]),
+		0,
+		3,
+		beginState,
+		chainState(beginState, 0, _headers[:3]),
+		NewMMR(hashes[:2]), NewMMR(hashes[2:3]),
 	)
+	assert.NoError(err)
 
 	recursiveCcs, err := operations.ReadCcs(recursiveCcsFile)
 	assert.NoError(err)
@@ -322,3 +374,154 @@ func TestBlockHeaderRecursiveCircuit_Recursive_0_3_Plonk(t *testing.T) {
 	err = operations.WriteWitness(witness, witnessFile)
 	assert.NoError(err)
 }
+
+func TestBlockHeaderRecursiveCircuit_Recursive_1_3_Plonk(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	firstProofFile := "../testdata/block_header_unit_1_2.proof"
+	firstWitnessFile := "../testdata/block_header_unit_1_2.wtns"
+	secondProofFile := "../testdata/block_header_unit_2_3.proof"
+	secondWitnessFile := "../testdata/block_header_unit_2_3.wtns"
+
+	_headers := make([][]byte, len(headers))
+	hashes := make([][32]byte, len(headers))
+
+	for i, h := range headers {
+		_headers[i], _ = hex.DecodeString(h)
+		hashes[i] = chainhash.DoubleHashH(_headers[i])
+	}
+
+	unitVk, err := operations.ReadVk(unitVkFile)
+	assert.NoError(err)
+
+	firstProof, err := operations.ReadProof(firstProofFile)
+	assert.NoError(err)
+
+	secondProof, err := operations.ReadProof(secondProofFile)
+	assert.NoError(err)
+
+	firstWitness, err := operations.ReadWitness(firstWitnessFile)
+	assert.NoError(err)
+
+	secondWitness, err := operations.ReadWitness(secondWitnessFile)
+	assert.NoError(err)
+
+	recursiveVk, err := operations.ReadVk(recursiveVkFile)
+	assert.NoError(err)
+
+	recursiveVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveVk)
+	assert.NoError(err)
+
+	recursiveVkFp := utils.FingerPrintFromBytes[sw_bn254.ScalarField](recursiveVkFpBytes)
+
+	assignment, err := NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		unitVk, unitVk,
+		firstProof, secondProof,
+		firstWitness, secondWitness,
+		recursiveVkFp,
+		hashes[0],
+		hashes[1],
+		hashes[2],
+		chainWork(_headers[1:3]),
+		1,
+		2,
+		chainState(beginState, 0, _headers[:1]),
+		chainState(beginState, 0, _headers[:3]),
+		NewMMR(hashes[1:2]), NewMMR(hashes[2:3]),
+	)
+	assert.NoError(err)
+
+	recursiveCcs, err := operations.ReadCcs(recursiveCcsFile)
+	assert.NoError(err)
+
+	recursivePk, err := operations.ReadPk(recursivePkFile)
+	assert.NoError(err)
+
+	proof, witness, err := operations.PlonkProve(recursiveCcs, recursivePk, assignment, false)
+	assert.NoError(err)
+
+	err = operations.PlonkVerify(recursiveVk, proof, witness, false)
+	assert.NoError(err)
+
+	proofFile := "../testdata/block_header_recursive_1_3.proof"
+	witnessFile := "../testdata/block_header_recursive_1_3.wtns"
+
+	err = operations.WriteProof(proof, proofFile)
+	assert.NoError(err)
+
+	err = operations.WriteWitness(witness, witnessFile)
+	assert.NoError(err)
+}
+
+// a unit proof followed by a recursive one, as produced when merging ranges as a tree
+func TestBlockHeaderRecursiveCircuit_Recursive_0_3_Tree_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	firstProofFile := "../testdata/block_header_unit_0_1.proof"
+	firstWitnessFile := "../testdata/block_header_unit_0_1.wtns"
+	secondProofFile := "../testdata/block_header_recursive_1_3.proof"
+	secondWitnessFile := "../testdata/block_header_recursive_1_3.wtns"
+
+	_headers := make([][]byte, len(headers))
+	hashes := make([][32]byte, len(headers))
+
+	for i, h := range headers {
+		_headers[i], _ = hex.DecodeString(h)
+		hashes[i] = chainhash.DoubleHashH(_headers[i])
+	}
+	beignHash := [32]byte(_headers[0][4:36])
+
+	unitCcs, err := operations.ReadCcs(unitCcsFile)
+	assert.NoError(err)
+
+	unitVk, err := operations.ReadVk(unitVkFile)
+	assert.NoError(err)
+
+	unitVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](unitVk)
+	assert.NoError(err)
+
+	circuit := NewBlockHeaderRecursiveCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		unitCcs,
+		unitVkFpBytes,
+	)
+
+	firstProof, err := operations.ReadProof(firstProofFile)
+	assert.NoError(err)
+
+	secondProof, err := operations.ReadProof(secondProofFile)
+	assert.NoError(err)
+
+	firstWitness, err := operations.ReadWitness(firstWitnessFile)
+	assert.NoError(err)
+
+	secondWitness, err := operations.ReadWitness(secondWitnessFile)
+	assert.NoError(err)
+
+	recursiveVk, err := operations.ReadVk(recursiveVkFile)
+	assert.NoError(err)
+
+	recursiveVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveVk)
+	assert.NoError(err)
+
+	recursiveVkFp := utils.FingerPrintFromBytes[sw_bn254.ScalarField](recursiveVkFpBytes)
+
+	assignment, err := NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		unitVk, recursiveVk,
+		firstProof, secondProof,
+		firstWitness, secondWitness,
+		recursiveVkFp,
+		beignHash,
+		hashes[0],
+		hashes[2],
+		chainWork(_headers[:3]),
+		0,
+		3,
+		beginState,
+		chainState(beginState, 0, _headers[:3]),
+		NewMMR(hashes[:1]), NewMMR(hashes[1:3]),
+	)
+	assert.NoError(err)
+
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+}
@@ -31,6 +31,13 @@ var (
 	recursiveCcsFile = "../testdata/block_header_recursive.ccs"
 	recursivePkFile  = "../testdata/block_header_recursive.pk"
 	recursiveVkFile  = "../testdata/block_header_recursive.vk"
+
+	//state after the block headers[0] builds on, headers lie in the first difficulty epoch
+	//the timestamps of its ancestors are approximated by the genesis time
+	beginState = NativeChainState{EpochBits: 0x1d00ffff, EpochStartTime: 1231006505, Bits: 0x1d00ffff, Timestamps: [MedianTimeSpan]uint32{
+		1231006505, 1231006505, 1231006505, 1231006505, 1231006505, 1231006505,
+		1231006505, 1231006505, 1231006505, 1231006505, 1231006505,
+	}}
 )
 
 func TestBlockHeaderUnitCircuit_Simulation(t *testing.T) {
@@ -43,8 +50,9 @@ func TestBlockHeaderUnitCircuit_Simulation(t *testing.T) {
 	vk, err := operations.ReadVk(unitVkFile)
 	vkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
 
-	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]()
-	assignment := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](hash, [80]byte(header), vkFpBytes)
+	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, ByteLayout)
+	assignment, err := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, [80]byte(header), 0, beginState, vkFpBytes, ByteLayout)
+	assert.NoError(err)
 
 	ccs, err := operations.NewConstraintSystem(circuit)
 	assert.NoError(err)
@@ -57,7 +65,7 @@ func TestBlockHeaderUnitCircuit_Simulation(t *testing.T) {
 func TestBlockHeaderUnitCircuit_Plonk254(t *testing.T) {
 	assert := test.NewAssert(t)
 
-	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]()
+	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, ByteLayout)
 
 	ccs, err := operations.NewConstraintSystem(circuit)
 	assert.NoError(err)
@@ -79,11 +87,16 @@ func TestBlockHeaderUnitCircuit_Plonk254(t *testing.T) {
 	assert.NoError(err)
 	fmt.Printf("vkFpBytes:%v\n", hex.EncodeToString(vkFpBytes))
 
+	state := beginState
 	for i := 0; i < 3; i++ {
 		header, err := hex.DecodeString(headers[i])
 		assert.NoError(err)
 		hash := chainhash.DoubleHashH(header)
-		assignment := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](hash, [80]byte(header), vkFpBytes)
+		assignment, err := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, [80]byte(header), uint32(i), state, vkFpBytes, ByteLayout)
+		assert.NoError(err)
+
+		state, err = state.Next(MainNet, uint32(i+1), [80]byte(header))
+		assert.NoError(err)
 
 		proof, wit, err := operations.PlonkProve(ccs, pk, assignment, false)
 		assert.NoError(err)
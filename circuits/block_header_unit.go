@@ -6,13 +6,30 @@ import (
 	"github.com/consensys/gnark/std/hash/sha2"
 	"github.com/consensys/gnark/std/math/emulated"
 	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
 	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
 )
 
 const BeginHashOffset = 4
 const HashLen = 32
 const BlockHeaderLen = 80
 
+// indexes of the public variables shared by the unit and recursive circuits in the byte layout,
+// Layout gives them in either layout
+const BeginHashIndex = 0
+const EndHashIndex = BeginHashIndex + HashLen
+const ChainWorkIndex = EndHashIndex + HashLen
+const BeginHeightIndex = ChainWorkIndex + 1
+const CountIndex = BeginHeightIndex + 1
+const BeginStateIndex = CountIndex + 1
+const EndStateIndex = BeginStateIndex + ChainStateLen
+const MMRRootIndex = EndStateIndex + ChainStateLen
+const VkFpIndex = MMRRootIndex + 1
+
+// heights and header counts are bounded so that their sums never wrap around the native field
+const HeightBits = 32
+
 type Hash [HashLen]uints.U8
 
 func (h Hash) AssertIsEqual(api frontend.API, other Hash) {
@@ -22,42 +39,100 @@ func (h Hash) AssertIsEqual(api frontend.API, other Hash) {
 }
 
 type BlockHeaderUnitCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT] struct {
-	BeginHash                 Hash                  `gnark:",public"`
-	EndHash                   Hash                  `gnark:",public"`
+	BeginHash                 PublicHash            `gnark:",public"`
+	EndHash                   PublicHash            `gnark:",public"`
+	ChainWork                 frontend.Variable     `gnark:",public"`
+	BeginHeight               frontend.Variable     `gnark:",public"`
+	Count                     frontend.Variable     `gnark:",public"`
+	BeginState                ChainState            `gnark:",public"`
+	EndState                  ChainState            `gnark:",public"`
+	MMRRoot                   frontend.Variable     `gnark:",public"`
 	PlaceHolderForRecursiveFp utils.FingerPrint[FR] `gnark:",public"`
 	BlockHeader               [BlockHeaderLen]uints.U8
+
+	Network *Network `gnark:"-"`
 }
 
 func (c *BlockHeaderUnitCircuit[FR, G1El, G2El, GtEl]) Define(api frontend.API) error {
-	parentHash := Hash(c.BlockHeader[BeginHashOffset : BeginHashOffset+HashLen])
-	parentHash.AssertIsEqual(api, c.BeginHash)
+	//a unit proof always covers exactly one header, on top of a block at BeginHeight
+	api.AssertIsEqual(c.Count, 1)
+	rangecheck.New(api).Check(c.BeginHeight, HeightBits)
+	c.BeginState.AssertIsValid(api)
+
+	beginHash := c.BeginHash.Unpack(api, Hash(c.BlockHeader[BeginHashOffset:BeginHashOffset+HashLen]))
+	hash, work, endState, err := AssertBlockHeader(api, c.Network, beginHash, c.BeginHeight, c.BeginState, c.BlockHeader[:])
+	if err != nil {
+		return err
+	}
+	c.EndHash.AssertIsHash(api, *hash)
+	api.AssertIsEqual(work, c.ChainWork)
+	endState.AssertIsEqual(api, c.EndState)
 
-	hash, err := DoubleSha256(api, c.BlockHeader[:])
+	leaf, err := MMRLeaf(api, *hash)
+	if err != nil {
+		return err
+	}
+	mmrRoot, err := MMRRoot(api, 1, SingleLeafMMR(leaf))
 	if err != nil {
 		return err
 	}
-	hash.AssertIsEqual(api, c.EndHash)
+	api.AssertIsEqual(mmrRoot, c.MMRRoot)
 	return nil
 }
 
-func NewBlockHeaderUnitCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT]() frontend.Circuit {
-	return &BlockHeaderUnitCircuit[FR, G1El, G2El, GtEl]{}
+// AssertBlockHeader asserts that header builds on the block with hash parentHash, height height and
+// consensus state state of network net, and returns the hash, the work and the consensus state of
+// header.
+func AssertBlockHeader(api frontend.API, net *Network, parentHash Hash, height frontend.Variable, state ChainState, header []uints.U8) (*Hash, frontend.Variable, ChainState, error) {
+	Hash(header[BeginHashOffset:BeginHashOffset+HashLen]).AssertIsEqual(api, parentHash)
+
+	hash, err := DoubleSha256(api, header)
+	if err != nil {
+		return nil, nil, ChainState{}, err
+	}
+
+	compact, err := AssertProofOfWork(api, net, header, *hash)
+	if err != nil {
+		return nil, nil, ChainState{}, err
+	}
+
+	work, err := WorkFromTarget(api, compact.Target)
+	if err != nil {
+		return nil, nil, ChainState{}, err
+	}
+
+	endState, err := NextChainState(api, net, height, state, header, compact)
+	if err != nil {
+		return nil, nil, ChainState{}, err
+	}
+	return hash, work, endState, nil
+}
+
+func NewBlockHeaderUnitCircuit[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](net *Network, layout Layout) frontend.Circuit {
+	return &BlockHeaderUnitCircuit[FR, G1El, G2El, GtEl]{
+		BeginHash: NewPublicHash(layout),
+		EndHash:   NewPublicHash(layout),
+		Network:   net,
+	}
 }
 
 func NewBlockHeaderUnitAssignment[FR emulated.FieldParams, G1El algebra.G1ElementT, G2El algebra.G2ElementT, GtEl algebra.GtElementT](
+	net *Network,
 	blockHash [HashLen]byte,
 	blockHeader [BlockHeaderLen]byte,
+	beginHeight uint32,
+	beginState NativeChainState,
 	unitVkFpBytes utils.FingerPrintBytes,
-) frontend.Circuit {
-
-	_parentHash := Hash{}
-	for i := 0; i < HashLen; i++ {
-		_parentHash[i] = uints.NewU8(blockHeader[i+BeginHashOffset])
+	layout Layout,
+) (frontend.Circuit, error) {
+	chainWork, err := HeaderWork(blockHeader)
+	if err != nil {
+		return nil, err
 	}
 
-	_blockHash := Hash{}
-	for i := 0; i < HashLen; i++ {
-		_blockHash[i] = uints.NewU8(blockHash[i])
+	endState, err := beginState.Next(net, beginHeight+1, blockHeader)
+	if err != nil {
+		return nil, err
 	}
 
 	_blockHeader := [BlockHeaderLen]uints.U8{}
@@ -66,13 +141,20 @@ func NewBlockHeaderUnitAssignment[FR emulated.FieldParams, G1El algebra.G1Elemen
 	}
 
 	unitVkFp := utils.FingerPrintFromBytes[FR](unitVkFpBytes)
+	mmrRoot := NewMMR([][HashLen]byte{blockHash}).Root()
 
 	return &BlockHeaderUnitCircuit[FR, G1El, G2El, GtEl]{
-		BeginHash:                 _parentHash,
-		EndHash:                   _blockHash,
+		BeginHash:                 PublicHashOf(layout, [HashLen]byte(blockHeader[BeginHashOffset:BeginHashOffset+HashLen])),
+		EndHash:                   PublicHashOf(layout, blockHash),
+		ChainWork:                 chainWork,
+		BeginHeight:               beginHeight,
+		Count:                     1,
+		BeginState:                ChainStateFromNative(beginState),
+		EndState:                  ChainStateFromNative(endState),
+		MMRRoot:                   mmrRoot.BigInt(new(big.Int)),
 		PlaceHolderForRecursiveFp: unitVkFp,
 		BlockHeader:               _blockHeader,
-	}
+	}, nil
 }
 
 func DoubleSha256(api frontend.API, data []uints.U8) (*Hash, error) {
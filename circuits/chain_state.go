@@ -0,0 +1,324 @@
+package circuits
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/cmp"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
+	"math/big"
+	"slices"
+)
+
+const TimestampOffset = 68
+const TimestampLen = 4
+
+// number of previous timestamps the median-time-past is taken over
+const MedianTimeSpan = 11
+
+// ChainState is the consensus state a block leaves behind for validating the next header.
+type ChainState struct {
+	EpochBits      frontend.Variable                 //nBits of the current difficulty epoch
+	EpochStartTime frontend.Variable                 //timestamp of the first block of the current difficulty epoch
+	Bits           frontend.Variable                 //nBits of the block itself, differs from EpochBits for min-difficulty blocks
+	Timestamps     [MedianTimeSpan]frontend.Variable //timestamps of the block and its ancestors, oldest first
+}
+
+const ChainStateLen = 3 + MedianTimeSpan
+
+func (s ChainState) AssertIsEqual(api frontend.API, other ChainState) {
+	api.AssertIsEqual(s.EpochBits, other.EpochBits)
+	api.AssertIsEqual(s.EpochStartTime, other.EpochStartTime)
+	api.AssertIsEqual(s.Bits, other.Bits)
+	for i := 0; i < MedianTimeSpan; i++ {
+		api.AssertIsEqual(s.Timestamps[i], other.Timestamps[i])
+	}
+}
+
+// Time returns the timestamp of the block itself.
+func (s ChainState) Time() frontend.Variable {
+	return s.Timestamps[MedianTimeSpan-1]
+}
+
+// AssertIsValid range checks every field of the state to 32 bits.
+func (s ChainState) AssertIsValid(api frontend.API) {
+	rcheck := rangecheck.New(api)
+	rcheck.Check(s.EpochBits, 32)
+	rcheck.Check(s.EpochStartTime, 32)
+	rcheck.Check(s.Bits, 32)
+	for i := 0; i < MedianTimeSpan; i++ {
+		rcheck.Check(s.Timestamps[i], 32)
+	}
+}
+
+// ChainStateFromWitness reads a ChainState laid out from the first element of public.
+func ChainStateFromWitness[FR emulated.FieldParams](api frontend.API, public []emulated.Element[FR]) ChainState {
+	vals := RetrieveVarsFromElements[FR](api, public[:ChainStateLen], 32)
+	return ChainState{
+		EpochBits:      vals[0],
+		EpochStartTime: vals[1],
+		Bits:           vals[2],
+		Timestamps:     [MedianTimeSpan]frontend.Variable(vals[3:]),
+	}
+}
+
+// NextChainState validates the nBits and time fields of header, the block at beginHeight+1,
+// against state and the rules of net, and returns the state after header. compact must be the
+// decoded nBits field of header, bounded by the proof of work limit of net as AssertProofOfWork
+// does.
+func NextChainState(api frontend.API, net *Network, beginHeight frontend.Variable, state ChainState, header []uints.U8, compact *Compact) (ChainState, error) {
+	uapi, err := uints.New[uints.U32](api)
+	if err != nil {
+		return ChainState{}, err
+	}
+
+	bits := uapi.ToValue(uints.U32(header[BitsOffset : BitsOffset+BitsLen]))
+	time := uapi.ToValue(uints.U32(header[TimestampOffset : TimestampOffset+TimestampLen]))
+
+	isRetarget, err := isMultipleOf(api, api.Add(beginHeight, 1), int(net.DifficultyAdjustmentInterval))
+	if err != nil {
+		return ChainState{}, err
+	}
+	comparator := cmp.NewBoundedComparator(api, big.NewInt(1<<34), false)
+
+	//nBits stays constant within an epoch
+	expectedBits := state.EpochBits
+	if net.AllowMinDifficultyBlocks {
+		//unless the block is late, which then must fall back to the minimum difficulty
+		isLate := comparator.IsLess(api.Add(state.Time(), 2*net.PowTargetSpacing), time)
+		expectedBits = api.Select(isLate, net.PowLimitBits, state.EpochBits)
+	}
+	isEpochBits := api.IsZero(api.Sub(bits, expectedBits))
+	api.AssertIsEqual(api.Mul(api.Sub(1, isRetarget), api.Sub(1, isEpochBits)), 0)
+
+	//the first block of an epoch carries the target retargeted from the previous epoch
+	var isExpected frontend.Variable
+	if net.NoRetargeting {
+		isExpected = api.IsZero(api.Sub(bits, state.Bits))
+	} else {
+		isExpected, err = isNextWorkRequired(api, net, state, compact)
+		if err != nil {
+			return ChainState{}, err
+		}
+	}
+	api.AssertIsEqual(api.Mul(isRetarget, api.Sub(1, isExpected)), 0)
+
+	if net.EnforceBIP94 {
+		isWarped := comparator.IsLess(api.Add(time, MaxTimewarp), state.Time())
+		api.AssertIsEqual(api.Mul(isRetarget, isWarped), 0)
+	}
+
+	assertAboveMedianTimePast(api, state, time)
+
+	next := ChainState{
+		EpochBits:      api.Select(isRetarget, bits, state.EpochBits),
+		EpochStartTime: api.Select(isRetarget, time, state.EpochStartTime),
+		Bits:           bits,
+	}
+	copy(next.Timestamps[:], state.Timestamps[1:])
+	next.Timestamps[MedianTimeSpan-1] = time
+	return next, nil
+}
+
+// assertAboveMedianTimePast asserts that time is greater than the median of the timestamps in
+// state, which is the case iff time is greater than more than half of them.
+func assertAboveMedianTimePast(api frontend.API, state ChainState, time frontend.Variable) {
+	comparator := cmp.NewBoundedComparator(api, big.NewInt(1<<33), false)
+	count := frontend.Variable(0)
+	for i := 0; i < MedianTimeSpan; i++ {
+		count = api.Add(count, comparator.IsLess(state.Timestamps[i], time))
+	}
+	comparator.AssertIsLessEq(MedianTimeSpan/2+1, count)
+}
+
+// isNextWorkRequired returns 1 if compact is the compact encoding of the target retargeted at the
+// end of the epoch described by state, following Bitcoin Core's CalculateNextWorkRequired.
+func isNextWorkRequired(api frontend.API, net *Network, state ChainState, compact *Compact) (frontend.Variable, error) {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return nil, err
+	}
+	uapi, err := uints.New[uints.U32](api)
+	if err != nil {
+		return nil, err
+	}
+
+	//both timestamps are 32 bits, so the timespan lies in (-2^32, 2^32)
+	comparator := cmp.NewBoundedComparator(api, big.NewInt(1<<34), false)
+	timespan := api.Sub(state.Time(), state.EpochStartTime)
+	timespan = api.Select(comparator.IsLess(timespan, net.PowTargetTimespan/4), net.PowTargetTimespan/4, timespan)
+	timespan = api.Select(comparator.IsLess(net.PowTargetTimespan*4, timespan), net.PowTargetTimespan*4, timespan)
+
+	//BIP94 retargets from the first block of the epoch, which is never a min-difficulty block
+	lastBits := state.Bits
+	if net.EnforceBIP94 {
+		lastBits = state.EpochBits
+	}
+	last := DecodeCompact(api, f, uapi.ValueOf(lastBits))
+	product := f.Mul(last.Target, bigIntFromLimb(f, timespan))
+
+	//target < 2^256 and timespan < 2^23, the quotient fits in 4 limbs
+	next, _, err := bigIntDivRem(api, f, product, bigIntConstant(big.NewInt(net.PowTargetTimespan)), 4)
+	if err != nil {
+		return nil, err
+	}
+	powLimit := bigIntConstant(net.PowLimit)
+	next = f.Select(bigIntIsLessOrEqual(api, f, next, powLimit), next, powLimit)
+
+	return isCompactOf(api, f, compact, next), nil
+}
+
+// isCompactOf returns 1 if compact is what Bitcoin Core's GetCompact returns for target, i.e. the
+// mantissa is normalized and target is truncated down to compact.Target.
+func isCompactOf(api frontend.API, f *emulated.Field[BigIntParams], compact *Compact, target *BigInt) frontend.Variable {
+	lower := bigIntIsLessOrEqual(api, f, compact.Target, target)
+	upper := bigIntIsLessOrEqual(api, f, f.Add(target, f.One()), f.Add(compact.Target, compact.Unit))
+
+	//the sign bit is already cleared by DecodeCompact, hence a normalized mantissa is >= 0x8000
+	comparator := cmp.NewBoundedComparator(api, big.NewInt(1<<24), false)
+	normalized := comparator.IsLess(0x7fff, compact.Mantissa)
+
+	return api.And(api.And(lower, upper), normalized)
+}
+
+// isMultipleOf returns 1 if v, a HeightBits wide value, is a multiple of n.
+func isMultipleOf(api frontend.API, v frontend.Variable, n int) (frontend.Variable, error) {
+	res, err := api.Compiler().NewHint(divModHint, 2, v, n)
+	if err != nil {
+		return nil, err
+	}
+	q, r := res[0], res[1]
+
+	rangecheck.New(api).Check(q, HeightBits)
+	cmp.NewBoundedComparator(api, big.NewInt(int64(n)), false).AssertIsLess(r, n)
+	api.AssertIsEqual(v, api.Add(api.Mul(q, n), r))
+
+	return api.IsZero(r), nil
+}
+
+// NativeChainState is the native counterpart of ChainState.
+type NativeChainState struct {
+	EpochBits      uint32
+	EpochStartTime uint32
+	Bits           uint32
+	Timestamps     [MedianTimeSpan]uint32
+}
+
+func (s NativeChainState) Time() uint32 {
+	return s.Timestamps[MedianTimeSpan-1]
+}
+
+// MedianTimePast returns the median of the timestamps in the state.
+func (s NativeChainState) MedianTimePast() uint32 {
+	sorted := s.Timestamps
+	slices.Sort(sorted[:])
+	return sorted[MedianTimeSpan/2]
+}
+
+// Next is the native counterpart of NextChainState, height is the height of header.
+func (s NativeChainState) Next(net *Network, height uint32, header [BlockHeaderLen]byte) (NativeChainState, error) {
+	bits := binary.LittleEndian.Uint32(header[BitsOffset:])
+	time := binary.LittleEndian.Uint32(header[TimestampOffset:])
+
+	_, err := net.CheckTarget(bits)
+	if err != nil {
+		return NativeChainState{}, fmt.Errorf("block %v: %v", height, err)
+	}
+	if time <= s.MedianTimePast() {
+		return NativeChainState{}, fmt.Errorf("block %v time %v not above median time past %v", height, time, s.MedianTimePast())
+	}
+
+	next := NativeChainState{EpochBits: s.EpochBits, EpochStartTime: s.EpochStartTime, Bits: bits}
+	copy(next.Timestamps[:], s.Timestamps[1:])
+	next.Timestamps[MedianTimeSpan-1] = time
+
+	if height%net.DifficultyAdjustmentInterval != 0 {
+		expected := s.EpochBits
+		if net.AllowMinDifficultyBlocks && int64(time) > int64(s.Time())+2*net.PowTargetSpacing {
+			expected = net.PowLimitBits
+		}
+		if bits != expected {
+			return NativeChainState{}, fmt.Errorf("block %v nBits %08x, expected %08x", height, bits, expected)
+		}
+		return next, nil
+	}
+
+	if net.EnforceBIP94 && int64(time)+MaxTimewarp < int64(s.Time()) {
+		return NativeChainState{}, fmt.Errorf("block %v time %v too far before its parent", height, time)
+	}
+
+	expected := s.Bits
+	if !net.NoRetargeting {
+		lastBits := s.Bits
+		if net.EnforceBIP94 {
+			lastBits = s.EpochBits
+		}
+
+		var err error
+		expected, err = net.CalculateNextWorkRequired(lastBits, int64(s.EpochStartTime), int64(s.Time()))
+		if err != nil {
+			return NativeChainState{}, err
+		}
+	}
+	if bits != expected {
+		return NativeChainState{}, fmt.Errorf("block %v nBits %08x, expected %08x after retarget", height, bits, expected)
+	}
+	next.EpochBits = bits
+	next.EpochStartTime = time
+	return next, nil
+}
+
+func ChainStateFromNative(s NativeChainState) ChainState {
+	ret := ChainState{
+		EpochBits:      s.EpochBits,
+		EpochStartTime: s.EpochStartTime,
+		Bits:           s.Bits,
+	}
+	for i := 0; i < MedianTimeSpan; i++ {
+		ret.Timestamps[i] = s.Timestamps[i]
+	}
+	return ret
+}
+
+// CalculateNextWorkRequired retargets lastBits by the timespan of the finished epoch, as Bitcoin
+// Core does.
+func (net *Network) CalculateNextWorkRequired(lastBits uint32, firstTime, lastTime int64) (uint32, error) {
+	timespan := lastTime - firstTime
+	if timespan < net.PowTargetTimespan/4 {
+		timespan = net.PowTargetTimespan / 4
+	}
+	if timespan > net.PowTargetTimespan*4 {
+		timespan = net.PowTargetTimespan * 4
+	}
+
+	target, err := CompactToTarget(lastBits)
+	if err != nil {
+		return 0, err
+	}
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(net.PowTargetTimespan))
+	if target.Cmp(net.PowLimit) > 0 {
+		target.Set(net.PowLimit)
+	}
+	return TargetToCompact(target), nil
+}
+
+// TargetToCompact is Bitcoin Core's GetCompact, the inverse of CompactToTarget up to truncation.
+func TargetToCompact(target *big.Int) uint32 {
+	size := uint32(len(target.Bytes()))
+	var compact uint32
+	if size <= 3 {
+		compact = uint32(target.Uint64()) << (8 * (3 - size))
+	} else {
+		compact = uint32(new(big.Int).Rsh(target, uint(8*(size-3))).Uint64())
+	}
+
+	//the mantissa is signed, move a set sign bit into the exponent
+	if compact&0x00800000 != 0 {
+		compact >>= 8
+		size++
+	}
+	return compact | size<<24
+}
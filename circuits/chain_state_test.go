@@ -0,0 +1,173 @@
+package circuits
+
+import (
+	"encoding/binary"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"testing"
+)
+
+// retarget vectors from Bitcoin Core's pow_tests.cpp
+var retargetVectors = []struct {
+	firstTime, lastTime int64
+	lastBits, nextBits  uint32
+}{
+	{1261130161, 1262152739, 0x1d00ffff, 0x1d00d86a}, //no constraint applies
+	{1231006505, 1233061996, 0x1d00ffff, 0x1d00ffff}, //pow limit
+	{1279008237, 1279297671, 0x1c05a3f4, 0x1c0168fd}, //lower bound of the timespan
+	{1263163443, 1269211443, 0x1c387f6f, 0x1d00e1fd}, //upper bound of the timespan
+}
+
+type retargetCircuit struct {
+	State      ChainState
+	Bits       [BitsLen]uints.U8
+	IsExpected frontend.Variable
+}
+
+func (c *retargetCircuit) Define(api frontend.API) error {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return err
+	}
+
+	isExpected, err := isNextWorkRequired(api, MainNet, c.State, DecodeCompact(api, f, c.Bits))
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(isExpected, c.IsExpected)
+	return nil
+}
+
+func newRetargetAssignment(firstTime, lastTime int64, lastBits, bits uint32, isExpected bool) *retargetCircuit {
+	var bitsBytes [BitsLen]byte
+	binary.LittleEndian.PutUint32(bitsBytes[:], bits)
+
+	expected := 0
+	if isExpected {
+		expected = 1
+	}
+	return &retargetCircuit{
+		State:      ChainStateFromNative(NativeChainState{EpochBits: lastBits, EpochStartTime: uint32(firstTime), Bits: lastBits, Timestamps: timestampsUntil(uint32(lastTime))}),
+		Bits:       [BitsLen]uints.U8(uints.NewU8Array(bitsBytes[:])),
+		IsExpected: expected,
+	}
+}
+
+// timestampsUntil returns a window of timestamps 10 minutes apart ending at last.
+func timestampsUntil(last uint32) [MedianTimeSpan]uint32 {
+	var ts [MedianTimeSpan]uint32
+	for i := range ts {
+		ts[i] = last - uint32(MedianTimeSpan-1-i)*600
+	}
+	return ts
+}
+
+type medianTimePastCircuit struct {
+	State ChainState
+	Time  frontend.Variable
+}
+
+func (c *medianTimePastCircuit) Define(api frontend.API) error {
+	assertAboveMedianTimePast(api, c.State, c.Time)
+	return nil
+}
+
+func TestCalculateNextWorkRequired(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, v := range retargetVectors {
+		bits, err := MainNet.CalculateNextWorkRequired(v.lastBits, v.firstTime, v.lastTime)
+		assert.NoError(err)
+		assert.Equal(v.nextBits, bits)
+
+		target, err := CompactToTarget(bits)
+		assert.NoError(err)
+		assert.Equal(bits, TargetToCompact(target))
+	}
+}
+
+func TestNativeChainState_Next(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var header [BlockHeaderLen]byte
+	binary.LittleEndian.PutUint32(header[TimestampOffset:], 1262152739+600)
+	binary.LittleEndian.PutUint32(header[BitsOffset:], 0x1d00ffff)
+
+	state := NativeChainState{EpochBits: 0x1d00ffff, EpochStartTime: 1261130161, Bits: 0x1d00ffff, Timestamps: timestampsUntil(1262152739)}
+	next, err := state.Next(MainNet, 32255, header)
+	assert.NoError(err)
+	assert.Equal(NativeChainState{EpochBits: 0x1d00ffff, EpochStartTime: 1261130161, Bits: 0x1d00ffff, Timestamps: timestampsUntil(1262152739 + 600)}, next)
+
+	//nBits must be retargeted at the epoch boundary
+	_, err = state.Next(MainNet, 32256, header)
+	assert.Error(err)
+
+	binary.LittleEndian.PutUint32(header[BitsOffset:], 0x1d00d86a)
+	next, err = state.Next(MainNet, 32256, header)
+	assert.NoError(err)
+	assert.Equal(NativeChainState{EpochBits: 0x1d00d86a, EpochStartTime: 1262152739 + 600, Bits: 0x1d00d86a, Timestamps: timestampsUntil(1262152739 + 600)}, next)
+
+	//and stays constant within an epoch
+	_, err = state.Next(MainNet, 32257, header)
+	assert.Error(err)
+}
+
+func TestNativeChainState_MedianTimePast(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	state := NativeChainState{EpochBits: 0x1d00ffff, Bits: 0x1d00ffff, Timestamps: [MedianTimeSpan]uint32{9, 1, 8, 2, 7, 3, 6, 4, 5, 11, 10}}
+	assert.Equal(uint32(6), state.MedianTimePast())
+
+	//the time may go backwards but must stay above the median
+	var header [BlockHeaderLen]byte
+	binary.LittleEndian.PutUint32(header[BitsOffset:], 0x1d00ffff)
+	binary.LittleEndian.PutUint32(header[TimestampOffset:], 7)
+	next, err := state.Next(MainNet, 1, header)
+	assert.NoError(err)
+	assert.Equal([MedianTimeSpan]uint32{1, 8, 2, 7, 3, 6, 4, 5, 11, 10, 7}, next.Timestamps)
+
+	binary.LittleEndian.PutUint32(header[TimestampOffset:], 6)
+	_, err = state.Next(MainNet, 1, header)
+	assert.Error(err)
+}
+
+func TestMedianTimePast_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	state := NativeChainState{EpochBits: 0x1d00ffff, Bits: 0x1d00ffff, Timestamps: [MedianTimeSpan]uint32{9, 1, 8, 2, 7, 3, 6, 4, 5, 11, 10}}
+	err := test.IsSolved(&medianTimePastCircuit{}, &medianTimePastCircuit{State: ChainStateFromNative(state), Time: 7}, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	err = test.IsSolved(&medianTimePastCircuit{}, &medianTimePastCircuit{State: ChainStateFromNative(state), Time: 6}, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//duplicates equal to the median do not count as below it
+	state.Timestamps = [MedianTimeSpan]uint32{1, 2, 3, 4, 5, 6, 6, 6, 6, 6, 6}
+	err = test.IsSolved(&medianTimePastCircuit{}, &medianTimePastCircuit{State: ChainStateFromNative(state), Time: 6}, ecc.BN254.ScalarField())
+	assert.Error(err)
+	err = test.IsSolved(&medianTimePastCircuit{}, &medianTimePastCircuit{State: ChainStateFromNative(state), Time: 7}, ecc.BN254.ScalarField())
+	assert.NoError(err)
+}
+
+func TestNextWorkRequired_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, v := range retargetVectors {
+		assignment := newRetargetAssignment(v.firstTime, v.lastTime, v.lastBits, v.nextBits, true)
+		err := test.IsSolved(&retargetCircuit{}, assignment, ecc.BN254.ScalarField())
+		assert.NoError(err)
+
+		assignment = newRetargetAssignment(v.firstTime, v.lastTime, v.lastBits, v.nextBits-1, false)
+		err = test.IsSolved(&retargetCircuit{}, assignment, ecc.BN254.ScalarField())
+		assert.NoError(err)
+	}
+
+	//same target as 0x1d00d86a but truncated with a non-normalized mantissa
+	v := retargetVectors[0]
+	assignment := newRetargetAssignment(v.firstTime, v.lastTime, v.lastBits, 0x1e0000d8, false)
+	err := test.IsSolved(&retargetCircuit{}, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+}
@@ -0,0 +1,30 @@
+package circuits
+
+import (
+	"github.com/consensys/gnark/constraint/solver"
+	"github.com/consensys/gnark/std/math/emulated"
+	"math/big"
+)
+
+func init() {
+	solver.RegisterHint(GetHints()...)
+}
+
+// GetHints returns all hint functions used in this package.
+func GetHints() []solver.Hint {
+	return []solver.Hint{divHint, divModHint}
+}
+
+// divHint computes the quotient and the remainder of two emulated integers.
+func divHint(_ *big.Int, inputs, outputs []*big.Int) error {
+	return emulated.UnwrapHint(inputs, outputs, func(_ *big.Int, inputs, outputs []*big.Int) error {
+		outputs[0].QuoRem(inputs[0], inputs[1], outputs[1])
+		return nil
+	})
+}
+
+// divModHint computes the quotient and the remainder of two native integers.
+func divModHint(_ *big.Int, inputs, outputs []*big.Int) error {
+	outputs[0].QuoRem(inputs[0], inputs[1], outputs[1])
+	return nil
+}
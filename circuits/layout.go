@@ -0,0 +1,201 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
+	"math/big"
+)
+
+// PackedHashLen is the number of public variables of a hash in the packed layout, each holding 128
+// bits of the hash.
+const PackedHashLen = 2
+
+const packedHashBytes = HashLen / PackedHashLen
+
+// NbPackedPublicVariables is the number of public variables of the circuits in the packed layout.
+const NbPackedPublicVariables = NbPublicVariables - 2*(HashLen-PackedHashLen)
+
+// Layout is the arrangement of the public variables shared by the unit, batch and recursive
+// circuits. In the byte layout a hash takes a public variable per byte, in the packed layout
+// PackedHashLen variables, which makes the public witness 37 variables instead of 97 and the
+// proofs cheaper to verify on chain. The other variables follow the hashes in the same order in
+// both layouts. All circuits of a recursive proof share the layout of its leaves.
+type Layout struct {
+	Packed bool
+}
+
+var (
+	ByteLayout   = Layout{}
+	PackedLayout = Layout{Packed: true}
+)
+
+// LayoutOf returns the layout with nbPublicVariables public variables.
+func LayoutOf(nbPublicVariables int) (Layout, error) {
+	switch nbPublicVariables {
+	case ByteLayout.NbPublicVariables():
+		return ByteLayout, nil
+	case PackedLayout.NbPublicVariables():
+		return PackedLayout, nil
+	}
+	return Layout{}, fmt.Errorf("%v public variables, expected %v or %v", nbPublicVariables, NbPublicVariables, NbPackedPublicVariables)
+}
+
+// HashLen returns the number of public variables of a hash.
+func (l Layout) HashLen() int {
+	if l.Packed {
+		return PackedHashLen
+	}
+	return HashLen
+}
+
+func (l Layout) BeginHashIndex() int {
+	return BeginHashIndex
+}
+
+func (l Layout) EndHashIndex() int {
+	return l.BeginHashIndex() + l.HashLen()
+}
+
+func (l Layout) ChainWorkIndex() int {
+	return l.EndHashIndex() + l.HashLen()
+}
+
+func (l Layout) BeginHeightIndex() int {
+	return l.ChainWorkIndex() + 1
+}
+
+func (l Layout) CountIndex() int {
+	return l.BeginHeightIndex() + 1
+}
+
+func (l Layout) BeginStateIndex() int {
+	return l.CountIndex() + 1
+}
+
+func (l Layout) EndStateIndex() int {
+	return l.BeginStateIndex() + ChainStateLen
+}
+
+func (l Layout) MMRRootIndex() int {
+	return l.EndStateIndex() + ChainStateLen
+}
+
+func (l Layout) VkFpIndex() int {
+	return l.MMRRootIndex() + 1
+}
+
+func (l Layout) NbPublicVariables() int {
+	return l.VkFpIndex() + 1
+}
+
+func (l Layout) String() string {
+	if l.Packed {
+		return "packed"
+	}
+	return "byte"
+}
+
+// PackHash packs hash into PackedHashLen values, the first taking its first 16 bytes as a big
+// endian number, and so on.
+func PackHash(hash [HashLen]byte) [PackedHashLen]*big.Int {
+	var packed [PackedHashLen]*big.Int
+	for i := range packed {
+		packed[i] = new(big.Int).SetBytes(hash[i*packedHashBytes : (i+1)*packedHashBytes])
+	}
+	return packed
+}
+
+// UnpackHash is the inverse of PackHash, it fails on values of more than 128 bits.
+func UnpackHash(packed [PackedHashLen]fr.Element) ([HashLen]byte, error) {
+	var hash [HashLen]byte
+	for i := range packed {
+		v := packed[i].BigInt(new(big.Int))
+		if v.BitLen() > 8*packedHashBytes {
+			return hash, fmt.Errorf("packed hash value %v exceeds %v bits", v, 8*packedHashBytes)
+		}
+		v.FillBytes(hash[i*packedHashBytes : (i+1)*packedHashBytes])
+	}
+	return hash, nil
+}
+
+// PublicHash is a hash exposed as public variables in the layout of its circuit.
+type PublicHash []frontend.Variable
+
+// NewPublicHash returns the placeholder of a hash in layout.
+func NewPublicHash(layout Layout) PublicHash {
+	return make(PublicHash, layout.HashLen())
+}
+
+// PublicHashOf returns the assignment of hash in layout.
+func PublicHashOf(layout Layout, hash [HashLen]byte) PublicHash {
+	h := NewPublicHash(layout)
+	if layout.Packed {
+		for i, v := range PackHash(hash) {
+			h[i] = v
+		}
+		return h
+	}
+	for i := range h {
+		h[i] = hash[i]
+	}
+	return h
+}
+
+func (h PublicHash) packed() bool {
+	return len(h) == PackedHashLen
+}
+
+// AssertIsHash asserts that h exposes hash. In the packed layout the bytes of hash are range
+// checked, so no two hashes pack alike.
+func (h PublicHash) AssertIsHash(api frontend.API, hash Hash) {
+	if !h.packed() {
+		for i := 0; i < HashLen; i++ {
+			api.AssertIsEqual(hash[i].Val, h[i])
+		}
+		return
+	}
+
+	rcheck := rangecheck.New(api)
+	for i := range h {
+		packed := frontend.Variable(0)
+		for _, b := range hash[i*packedHashBytes : (i+1)*packedHashBytes] {
+			rcheck.Check(b.Val, 8)
+			packed = api.Add(api.Mul(packed, 256), b.Val)
+		}
+		api.AssertIsEqual(h[i], packed)
+	}
+}
+
+// Unpack returns the bytes of h. A packed hash cannot be split into bytes cheaply, the caller
+// gives the bytes it must pack from instead, which are then asserted to.
+func (h PublicHash) Unpack(api frontend.API, hash Hash) Hash {
+	if !h.packed() {
+		var ret Hash
+		for i := range ret {
+			ret[i] = uints.U8{Val: h[i]}
+		}
+		return ret
+	}
+	h.AssertIsHash(api, hash)
+	return hash
+}
+
+func (h PublicHash) AssertIsEqual(api frontend.API, other PublicHash) {
+	for i := range h {
+		api.AssertIsEqual(h[i], other[i])
+	}
+}
+
+// PublicHashFromWitness returns the hash at the start of public, public variables of a proof in
+// layout. In both layouts the limbs above the bits a variable of the hash holds are asserted zero.
+func PublicHashFromWitness[FR emulated.FieldParams](api frontend.API, layout Layout, public []emulated.Element[FR]) PublicHash {
+	bits := 8
+	if layout.Packed {
+		bits = 8 * packedHashBytes
+	}
+	return RetrieveVarsFromElements[FR](api, public[:layout.HashLen()], uint(bits))
+}
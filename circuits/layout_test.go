@@ -0,0 +1,336 @@
+package circuits
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+	"testing"
+)
+
+func TestPackHash(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	header, err := hex.DecodeString(headers[0])
+	assert.NoError(err)
+	hash := chainhash.DoubleHashH(header)
+
+	packed := PackHash(hash)
+	assert.Equal(hex.EncodeToString(hash[:16]), hex.EncodeToString(packed[0].Bytes()))
+	assert.True(packed[1].BitLen() <= 128)
+
+	var elements [PackedHashLen]fr.Element
+	for i := range packed {
+		elements[i].SetBigInt(packed[i])
+	}
+	unpacked, err := UnpackHash(elements)
+	assert.NoError(err)
+	assert.Equal([HashLen]byte(hash), unpacked)
+
+	elements[1].SetBigInt(new(big.Int).Lsh(big.NewInt(1), 128))
+	_, err = UnpackHash(elements)
+	assert.Error(err)
+
+	assert.Equal(37, NbPackedPublicVariables)
+	assert.Equal(NbPackedPublicVariables, PackedLayout.NbPublicVariables())
+	for _, layout := range []Layout{ByteLayout, PackedLayout} {
+		l, err := LayoutOf(layout.NbPublicVariables())
+		assert.NoError(err)
+		assert.Equal(layout, l)
+	}
+	assert.Equal(NbPublicVariables, ByteLayout.NbPublicVariables())
+	assert.Equal(VkFpIndex, ByteLayout.VkFpIndex())
+	_, err = LayoutOf(NbPublicVariables - 1)
+	assert.Error(err)
+}
+
+type publicHashFromWitnessCircuit struct {
+	Public []emulated.Element[sw_bn254.ScalarField]
+	Hash   Hash
+	Layout Layout `gnark:"-"`
+}
+
+func (c *publicHashFromWitnessCircuit) Define(api frontend.API) error {
+	PublicHashFromWitness[sw_bn254.ScalarField](api, c.Layout, c.Public).AssertIsHash(api, c.Hash)
+	return nil
+}
+
+func TestPublicHashFromWitness(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	header, err := hex.DecodeString(headers[0])
+	assert.NoError(err)
+	hash := chainhash.DoubleHashH(header)
+
+	for _, layout := range []Layout{ByteLayout, PackedLayout} {
+		assignment := func() *publicHashFromWitnessCircuit {
+			c := &publicHashFromWitnessCircuit{Public: make([]emulated.Element[sw_bn254.ScalarField], layout.HashLen()), Hash: Hash(uints.NewU8Array(hash[:]))}
+			for i, v := range PublicHashOf(layout, hash) {
+				c.Public[i] = emulated.ValueOf[sw_bn254.ScalarField](v)
+			}
+			return c
+		}
+		circuit := &publicHashFromWitnessCircuit{Public: make([]emulated.Element[sw_bn254.ScalarField], layout.HashLen()), Layout: layout}
+		assert.NoError(test.IsSolved(circuit, assignment(), ecc.BN254.ScalarField()), layout)
+
+		//a variable with bits in a higher limb than the hash takes
+		tampered := assignment()
+		tampered.Public[0].Limbs[len(tampered.Public[0].Limbs)-1] = 1
+		assert.Error(test.IsSolved(circuit, tampered, ecc.BN254.ScalarField()), layout)
+	}
+}
+
+func TestDecodePublicWitness_Packed(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, len(headers))
+	for i, h := range headers {
+		header, err := hex.DecodeString(h)
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+	}
+
+	decoded := make(map[Layout]*PublicWitness)
+	for _, layout := range []Layout{ByteLayout, PackedLayout} {
+		assignment, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, blockHeaders, 0, beginState, make([]byte, 32), layout)
+		assert.NoError(err)
+		wit, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		assert.NoError(err)
+		assert.Equal(layout.NbPublicVariables(), len(wit.Vector().(fr.Vector)))
+
+		decoded[layout], err = DecodePublicWitness(wit)
+		assert.NoError(err)
+		assert.Equal(layout, decoded[layout].Layout)
+	}
+
+	//both layouts tell the same
+	packed := *decoded[PackedLayout]
+	packed.Layout = ByteLayout
+	assert.Equal(decoded[ByteLayout], &packed)
+}
+
+func TestBlockHeaderBatchCircuit_Packed_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, 2)
+	for i := range blockHeaders {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+	}
+
+	circuit := NewBlockHeaderBatchCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, len(blockHeaders), PackedLayout)
+	assignment, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, blockHeaders, 0, beginState, make([]byte, 32), PackedLayout)
+	assert.NoError(err)
+
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//the packed halves must be those of the hashes
+	for _, swap := range []bool{false, true} {
+		bad := *(assignment.(*BlockHeaderBatchCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]))
+		if swap {
+			bad.EndHash = PublicHash{bad.EndHash[1], bad.EndHash[0]}
+		} else {
+			bad.BeginHash = PublicHash{bad.BeginHash[0], new(big.Int).Add(bad.BeginHash[1].(*big.Int), big.NewInt(1))}
+		}
+		err = test.IsSolved(circuit, &bad, ecc.BN254.ScalarField())
+		assert.Error(err)
+	}
+}
+
+// fakeLeafCircuit has the packed public layout of the leaves and proves nothing about it. It uses
+// every kind of gate, the fingerprints of a vk with an empty selector differ natively and in circuit.
+type fakeLeafCircuit struct {
+	Public [NbPackedPublicVariables]frontend.Variable `gnark:",public"`
+	Out    frontend.Variable
+}
+
+func (c *fakeLeafCircuit) Define(api frontend.API) error {
+	square := api.Mul(c.Public[0], c.Public[0])
+	api.AssertIsEqual(api.Add(square, c.Public[1], 3), c.Out)
+	return nil
+}
+
+func TestBlockHeaderRecursiveCircuit_Packed_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &fakeLeafCircuit{})
+	assert.NoError(err)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	pk, vk, err := native_plonk.Setup(ccs, srs, lsrs)
+	assert.NoError(err)
+	vkFp, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	assert.NoError(err)
+
+	_headers := make([][BlockHeaderLen]byte, 2)
+	hashes := make([][HashLen]byte, 2)
+	for i := range _headers {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		_headers[i] = [BlockHeaderLen]byte(header)
+		hashes[i] = chainhash.DoubleHashH(header)
+	}
+
+	//leaf proofs of the fake circuit, over the packed public witnesses of the headers
+	state := beginState
+	proofs := make([]native_plonk.Proof, 2)
+	witnesses := make([]witness.Witness, 2)
+	for i := range _headers {
+		batch, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, _headers[i:i+1], uint32(i), state, vkFp, PackedLayout)
+		assert.NoError(err)
+		public, err := frontend.NewWitness(batch, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		assert.NoError(err)
+		vec := public.Vector().(fr.Vector)
+
+		leaf := &fakeLeafCircuit{}
+		for j := range leaf.Public {
+			leaf.Public[j] = vec[j]
+		}
+		var out fr.Element
+		out.Square(&vec[0]).Add(&out, &vec[1]).Add(&out, new(fr.Element).SetUint64(3))
+		leaf.Out = out
+		proofs[i], witnesses[i], err = operations.PlonkProve(ccs, pk, leaf, false)
+		assert.NoError(err)
+
+		state, err = state.Next(MainNet, uint32(i+1), _headers[i])
+		assert.NoError(err)
+	}
+
+	recursiveVkFp := make([]byte, 32)
+	recursiveVkFp[31] = 1
+	circuit := NewBlockHeaderRecursiveCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](ccs, vkFp)
+	assignment := func(endHash [HashLen]byte) frontend.Circuit {
+		work := new(big.Int)
+		for _, header := range _headers {
+			w, err := HeaderWork(header)
+			assert.NoError(err)
+			work.Add(work, w)
+		}
+		a, err := NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+			vk, vk,
+			proofs[0], proofs[1],
+			witnesses[0], witnesses[1],
+			utils.FingerPrintFromBytes[sw_bn254.ScalarField](recursiveVkFp),
+			[HashLen]byte(_headers[0][BeginHashOffset:BeginHashOffset+HashLen]),
+			hashes[0],
+			endHash,
+			work,
+			0,
+			2,
+			beginState,
+			state,
+			NewMMR(hashes[:1]), NewMMR(hashes[1:2]),
+		)
+		assert.NoError(err)
+		return a
+	}
+
+	err = test.IsSolved(circuit, assignment(hashes[1]), ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//the end hash must be the one of the second child
+	err = test.IsSolved(circuit, assignment(hashes[0]), ecc.BN254.ScalarField())
+	assert.Error(err)
+}
+
+// the artifacts of the circuits in the packed layout, and the unit proofs of headers[i] they merge
+// in block_header_unit_packed_i_i+1
+var (
+	packedUnitCcsFile      = "../testdata/block_header_unit_packed.ccs"
+	packedUnitPkFile       = "../testdata/block_header_unit_packed.pk"
+	packedUnitVkFile       = "../testdata/block_header_unit_packed.vk"
+	packedRecursiveCcsFile = "../testdata/block_header_recursive_packed.ccs"
+	packedRecursivePkFile  = "../testdata/block_header_recursive_packed.pk"
+	packedRecursiveVkFile  = "../testdata/block_header_recursive_packed.vk"
+)
+
+func TestBlockHeaderUnitCircuit_Packed_Plonk254(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, PackedLayout)
+
+	ccs, err := operations.NewConstraintSystem(circuit)
+	assert.NoError(err)
+	assert.Equal(NbPackedPublicVariables, ccs.GetNbPublicVariables())
+	srs, lsrs, err := operations.ReadSrs(ccs.GetNbConstraints()+ccs.GetNbPublicVariables(), "../srs")
+	assert.NoError(err)
+
+	pk, vk, err := operations.PlonkSetup(ccs, srs, lsrs)
+	assert.NoError(err)
+
+	err = operations.WriteCcs(ccs, packedUnitCcsFile)
+	assert.NoError(err)
+	err = operations.WritePk(pk, packedUnitPkFile)
+	assert.NoError(err)
+	err = operations.WriteVk(vk, packedUnitVkFile)
+	assert.NoError(err)
+
+	vkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	assert.NoError(err)
+
+	state := beginState
+	for i := 0; i < 2; i++ {
+		header, err := hex.DecodeString(headers[i])
+		assert.NoError(err)
+		hash := chainhash.DoubleHashH(header)
+		assignment, err := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, [80]byte(header), uint32(i), state, vkFpBytes, PackedLayout)
+		assert.NoError(err)
+
+		state, err = state.Next(MainNet, uint32(i+1), [80]byte(header))
+		assert.NoError(err)
+
+		proof, wit, err := operations.PlonkProve(ccs, pk, assignment, false)
+		assert.NoError(err)
+		err = operations.PlonkVerify(vk, proof, wit, false)
+		assert.NoError(err)
+
+		err = operations.WriteProof(proof, fmt.Sprintf("../testdata/block_header_unit_packed_%v_%v.proof", i, i+1))
+		assert.NoError(err)
+		err = operations.WriteWitness(wit, fmt.Sprintf("../testdata/block_header_unit_packed_%v_%v.wtns", i, i+1))
+		assert.NoError(err)
+	}
+}
+
+func TestBlockHeaderRecursiveCircuit_Packed_Setup(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	unitCcs, err := operations.ReadCcs(packedUnitCcsFile)
+	assert.NoError(err)
+	unitVk, err := operations.ReadVk(packedUnitVkFile)
+	assert.NoError(err)
+	unitVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](unitVk)
+	assert.NoError(err)
+
+	//the layout follows the one of the unit circuit
+	circuit := NewBlockHeaderRecursiveCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](unitCcs, unitVkFpBytes)
+	ccs, err := operations.NewConstraintSystem(circuit)
+	assert.NoError(err)
+	assert.Equal(NbPackedPublicVariables, ccs.GetNbPublicVariables())
+	srs, lsrs, err := operations.ReadSrs(ccs.GetNbConstraints()+ccs.GetNbPublicVariables(), "../srs")
+	assert.NoError(err)
+
+	pk, vk, err := operations.PlonkSetup(ccs, srs, lsrs)
+	assert.NoError(err)
+
+	err = operations.WriteCcs(ccs, packedRecursiveCcsFile)
+	assert.NoError(err)
+	err = operations.WritePk(pk, packedRecursivePkFile)
+	assert.NoError(err)
+	err = operations.WriteVk(vk, packedRecursiveVkFile)
+	assert.NoError(err)
+}
@@ -0,0 +1,366 @@
+package circuits
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_mimc "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"math/big"
+	"math/bits"
+	"slices"
+)
+
+// The headers of a range are accumulated in a Merkle Mountain Range over their hashes, which lets
+// a verifier of a range proof check that any block of the range is part of it. MMR nodes are MiMC
+// hashes over BN254, which keeps the accumulator cheap in circuit and its root a single field
+// element.
+
+// MMRMaxHeight bounds the height of the MMR peaks, so an MMR holds less than 2^MMRMaxHeight leaves.
+const MMRMaxHeight = HeightBits
+
+// MMRPeaks[h] is the root of the perfect subtree of 2^h leaves if the number of leaves has bit h
+// set, 0 otherwise. Larger subtrees hold older leaves.
+type MMRPeaks [MMRMaxHeight]frontend.Variable
+
+// MMRLeaf returns the leaf of a block hash, the MiMC hash of its two 128-bit halves.
+func MMRLeaf(api frontend.API, hash Hash) (frontend.Variable, error) {
+	var halves [2]frontend.Variable
+	for i := range halves {
+		halves[i] = frontend.Variable(0)
+		for j := 0; j < HashLen/2; j++ {
+			halves[i] = api.Add(api.Mul(halves[i], 256), hash[i*HashLen/2+j].Val)
+		}
+	}
+	return mimcHash(api, halves[:]...)
+}
+
+// MMRRoot commits to the number of leaves and the peaks of an MMR.
+func MMRRoot(api frontend.API, count frontend.Variable, peaks MMRPeaks) (frontend.Variable, error) {
+	return mimcHash(api, append([]frontend.Variable{count}, peaks[:]...)...)
+}
+
+// SingleLeafMMR returns the peaks of an MMR holding leaf only.
+func SingleLeafMMR(leaf frontend.Variable) MMRPeaks {
+	var peaks MMRPeaks
+	for h := range peaks {
+		peaks[h] = 0
+	}
+	peaks[0] = leaf
+	return peaks
+}
+
+// MergeMMR returns the peaks of the MMR over the leaves of first followed by the leaves of second.
+// The leaves of second must line up with the subtrees of first, i.e. firstCount must be a multiple
+// of the largest peak of second, which holds for appending single leaves and for merging ranges of
+// equal power of two sizes.
+func MergeMMR(api frontend.API, firstCount frontend.Variable, first MMRPeaks, secondCount frontend.Variable, second MMRPeaks) (MMRPeaks, error) {
+	firstBits := api.ToBinary(firstCount, MMRMaxHeight)
+	secondBits := api.ToBinary(secondCount, MMRMaxHeight)
+
+	//first has no peak below the largest peak of second
+	isBelow := frontend.Variable(0)
+	for h := MMRMaxHeight - 1; h >= 0; h-- {
+		api.AssertIsEqual(api.Mul(firstBits[h], isBelow), 0)
+		isBelow = api.Or(isBelow, secondBits[h])
+	}
+
+	//add the peaks like binary numbers, a carry only comes up above the largest peak of second so
+	//at most two of the first peak, the second peak and the carry are present at each height
+	var peaks MMRPeaks
+	carry := frontend.Variable(0)
+	carryPeak := frontend.Variable(0)
+	for h := 0; h < MMRMaxHeight; h++ {
+		right := api.Select(secondBits[h], second[h], carryPeak)
+		isRight := api.Add(secondBits[h], carry)
+
+		merged, err := mimcHash(api, first[h], right)
+		if err != nil {
+			return MMRPeaks{}, err
+		}
+
+		isPeak := api.Sub(api.Add(firstBits[h], isRight), api.Mul(2, firstBits[h], isRight))
+		peaks[h] = api.Select(isPeak, api.Select(firstBits[h], first[h], right), 0)
+
+		carry = api.Mul(firstBits[h], isRight)
+		carryPeak = merged
+	}
+	api.AssertIsEqual(carry, 0)
+	return peaks, nil
+}
+
+func mimcHash(api frontend.API, data ...frontend.Variable) (frontend.Variable, error) {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data...)
+	return h.Sum(), nil
+}
+
+// MMR is the native counterpart of the in-circuit accumulator. It keeps every leaf to build
+// inclusion proofs, unless it was restored from its peaks only.
+type MMR struct {
+	count  uint32
+	peaks  [MMRMaxHeight]fr.Element
+	leaves []fr.Element
+	pruned bool //leaves are not kept
+}
+
+func NewMMR(hashes [][HashLen]byte) *MMR {
+	m := &MMR{}
+	for _, hash := range hashes {
+		m.Append(hash)
+	}
+	return m
+}
+
+// MMRFromPeaks restores an MMR of count leaves from its peaks. It can be extended but can not
+// prove the inclusion of its leaves.
+func MMRFromPeaks(count uint32, peaks [MMRMaxHeight]fr.Element) (*MMR, error) {
+	for h := 0; h < MMRMaxHeight; h++ {
+		if count&(1<<h) == 0 && !peaks[h].IsZero() {
+			return nil, fmt.Errorf("peak at height %v of an mmr of %v leaves", h, count)
+		}
+	}
+	return &MMR{count: count, peaks: peaks, pruned: true}, nil
+}
+
+// Append adds a block hash, in internal byte order, to the MMR.
+func (m *MMR) Append(hash [HashLen]byte) {
+	leaf := NativeMMRLeaf(hash)
+	if !m.pruned {
+		m.leaves = append(m.leaves, leaf)
+	}
+
+	//the new leaf merges with the peaks up to the first missing height
+	node := leaf
+	h := 0
+	for ; m.count&(1<<h) != 0; h++ {
+		node = mmrParent(m.peaks[h], node)
+		m.peaks[h].SetZero()
+	}
+	m.peaks[h] = node
+	m.count++
+}
+
+func (m *MMR) Count() uint32 {
+	return m.count
+}
+
+func (m *MMR) Peaks() [MMRMaxHeight]fr.Element {
+	return m.peaks
+}
+
+func (m *MMR) Root() fr.Element {
+	return NativeMMRRoot(m.Count(), m.Peaks())
+}
+
+// Merge is the native counterpart of MergeMMR, it returns the MMR over the leaves of m followed by
+// the leaves of other under the same alignment condition.
+func (m *MMR) Merge(other *MMR) (*MMR, error) {
+	if other.count > 0 {
+		largest := uint32(1) << (bits.Len32(other.count) - 1)
+		if m.count%largest != 0 {
+			return nil, fmt.Errorf("mmr of %v leaves does not line up with a peak of %v leaves", m.count, largest)
+		}
+	}
+	if uint64(m.count)+uint64(other.count) >= 1<<MMRMaxHeight {
+		return nil, fmt.Errorf("mmr of %v leaves too large", uint64(m.count)+uint64(other.count))
+	}
+
+	ret := &MMR{count: m.count + other.count, pruned: m.pruned || other.pruned}
+	if !ret.pruned {
+		ret.leaves = append(slices.Clone(m.leaves), other.leaves...)
+	}
+
+	var carry fr.Element
+	hasCarry := false
+	for h := 0; h < MMRMaxHeight; h++ {
+		hasLeft := m.count&(1<<h) != 0
+		right, hasRight := carry, hasCarry
+		if other.count&(1<<h) != 0 {
+			right, hasRight = other.peaks[h], true
+		}
+
+		hasCarry = hasLeft && hasRight
+		switch {
+		case hasCarry:
+			carry = mmrParent(m.peaks[h], right)
+		case hasLeft:
+			ret.peaks[h] = m.peaks[h]
+		case hasRight:
+			ret.peaks[h] = right
+		}
+	}
+	return ret, nil
+}
+
+type mmrJson struct {
+	Count uint32
+	Peaks []string //hex encoded, from height 0 up to the largest peak
+}
+
+// MarshalJSON encodes the count and the peaks of the MMR, the leaves are dropped.
+func (m *MMR) MarshalJSON() ([]byte, error) {
+	ret := mmrJson{Count: m.count}
+	for h := 0; h < bits.Len32(m.count); h++ {
+		b := m.peaks[h].Bytes()
+		ret.Peaks = append(ret.Peaks, hex.EncodeToString(b[:]))
+	}
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON restores a pruned MMR.
+func (m *MMR) UnmarshalJSON(data []byte) error {
+	var v mmrJson
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	if len(v.Peaks) > MMRMaxHeight {
+		return fmt.Errorf("%v mmr peaks", len(v.Peaks))
+	}
+
+	var peaks [MMRMaxHeight]fr.Element
+	for h, peak := range v.Peaks {
+		b, err := hex.DecodeString(peak)
+		if err != nil {
+			return err
+		}
+		err = peaks[h].SetBytesCanonical(b)
+		if err != nil {
+			return fmt.Errorf("mmr peak %v: %v", h, err)
+		}
+	}
+
+	restored, err := MMRFromPeaks(v.Count, peaks)
+	if err != nil {
+		return err
+	}
+	*m = *restored
+	return nil
+}
+
+// MMRProof proves that the leaf at Index is part of an MMR of Count leaves.
+type MMRProof struct {
+	Index    uint32
+	Count    uint32
+	Siblings []fr.Element //from the leaf up to its peak
+	Peaks    [MMRMaxHeight]fr.Element
+}
+
+// Proof returns the inclusion proof of the leaf at index.
+func (m *MMR) Proof(index uint32) (*MMRProof, error) {
+	if index >= m.Count() {
+		return nil, fmt.Errorf("index %v out of %v leaves", index, m.Count())
+	}
+	if m.pruned {
+		return nil, fmt.Errorf("mmr restored from its peaks has no leaves to prove")
+	}
+
+	offset, height := mmrPeakOf(m.Count(), index)
+	level := m.leaves[offset : offset+1<<height]
+	local := index - offset
+
+	var siblings []fr.Element
+	for len(level) > 1 {
+		siblings = append(siblings, level[local^1])
+		level = mmrParents(level)
+		local >>= 1
+	}
+
+	return &MMRProof{
+		Index:    index,
+		Count:    m.Count(),
+		Siblings: siblings,
+		Peaks:    m.Peaks(),
+	}, nil
+}
+
+// VerifyMMRProof checks that hash is the leaf at proof.Index of the MMR with the given root.
+func VerifyMMRProof(root fr.Element, hash [HashLen]byte, proof *MMRProof) error {
+	if proof.Index >= proof.Count {
+		return fmt.Errorf("index %v out of %v leaves", proof.Index, proof.Count)
+	}
+
+	offset, height := mmrPeakOf(proof.Count, proof.Index)
+	if len(proof.Siblings) != height {
+		return fmt.Errorf("%v siblings for a peak of height %v", len(proof.Siblings), height)
+	}
+
+	node := NativeMMRLeaf(hash)
+	local := proof.Index - offset
+	for _, sibling := range proof.Siblings {
+		if local&1 == 1 {
+			node = mmrParent(sibling, node)
+		} else {
+			node = mmrParent(node, sibling)
+		}
+		local >>= 1
+	}
+
+	if !node.Equal(&proof.Peaks[height]) {
+		return fmt.Errorf("leaf %v does not lead to its peak", proof.Index)
+	}
+	expected := NativeMMRRoot(proof.Count, proof.Peaks)
+	if !expected.Equal(&root) {
+		return fmt.Errorf("peaks do not match the root")
+	}
+	return nil
+}
+
+// NativeMMRLeaf is the native counterpart of MMRLeaf.
+func NativeMMRLeaf(hash [HashLen]byte) fr.Element {
+	var halves [2]fr.Element
+	halves[0].SetBigInt(new(big.Int).SetBytes(hash[:HashLen/2]))
+	halves[1].SetBigInt(new(big.Int).SetBytes(hash[HashLen/2:]))
+	return nativeMimcHash(halves[:]...)
+}
+
+// NativeMMRRoot is the native counterpart of MMRRoot.
+func NativeMMRRoot(count uint32, peaks [MMRMaxHeight]fr.Element) fr.Element {
+	data := make([]fr.Element, 1, MMRMaxHeight+1)
+	data[0].SetUint64(uint64(count))
+	return nativeMimcHash(append(data, peaks[:]...)...)
+}
+
+// mmrPeakOf returns the first leaf and the height of the peak holding the leaf at index.
+func mmrPeakOf(count, index uint32) (uint32, int) {
+	offset := uint32(0)
+	for h := MMRMaxHeight - 1; h >= 0; h-- {
+		if count&(1<<h) == 0 {
+			continue
+		}
+		if index < offset+1<<h {
+			return offset, h
+		}
+		offset += 1 << h
+	}
+	panic("index out of range")
+}
+
+func mmrParents(level []fr.Element) []fr.Element {
+	parents := make([]fr.Element, len(level)/2)
+	for i := range parents {
+		parents[i] = mmrParent(level[2*i], level[2*i+1])
+	}
+	return parents
+}
+
+func mmrParent(left, right fr.Element) fr.Element {
+	return nativeMimcHash(left, right)
+}
+
+func nativeMimcHash(data ...fr.Element) fr.Element {
+	h := native_mimc.NewMiMC()
+	for i := range data {
+		b := data[i].Bytes()
+		h.Write(b[:])
+	}
+	var ret fr.Element
+	ret.SetBytes(h.Sum(nil))
+	return ret
+}
@@ -0,0 +1,151 @@
+package circuits
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+	"math/big"
+	"math/bits"
+	"testing"
+)
+
+type mergeMMRCircuit struct {
+	FirstCount  frontend.Variable
+	FirstPeaks  MMRPeaks
+	SecondCount frontend.Variable
+	SecondPeaks MMRPeaks
+	Root        frontend.Variable
+}
+
+func (c *mergeMMRCircuit) Define(api frontend.API) error {
+	peaks, err := MergeMMR(api, c.FirstCount, c.FirstPeaks, c.SecondCount, c.SecondPeaks)
+	if err != nil {
+		return err
+	}
+	root, err := MMRRoot(api, api.Add(c.FirstCount, c.SecondCount), peaks)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(root, c.Root)
+	return nil
+}
+
+func mmrHashes(n int) [][HashLen]byte {
+	hashes := make([][HashLen]byte, n)
+	for i := range hashes {
+		hashes[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	return hashes
+}
+
+func newMergeMMRAssignment(hashes [][HashLen]byte, n int) *mergeMMRCircuit {
+	first, second := NewMMR(hashes[:n]), NewMMR(hashes[n:])
+	firstPeaks, secondPeaks := first.Peaks(), second.Peaks()
+	root := NewMMR(hashes).Root()
+
+	assignment := &mergeMMRCircuit{
+		FirstCount:  first.Count(),
+		SecondCount: second.Count(),
+		Root:        root.BigInt(new(big.Int)),
+	}
+	for h := 0; h < MMRMaxHeight; h++ {
+		assignment.FirstPeaks[h] = firstPeaks[h].BigInt(new(big.Int))
+		assignment.SecondPeaks[h] = secondPeaks[h].BigInt(new(big.Int))
+	}
+	return assignment
+}
+
+func TestMMRProof(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	hashes := mmrHashes(21)
+	for n := 1; n <= len(hashes); n++ {
+		mmr := NewMMR(hashes[:n])
+		root := mmr.Root()
+
+		for i := 0; i < n; i++ {
+			proof, err := mmr.Proof(uint32(i))
+			assert.NoError(err)
+			assert.NoError(VerifyMMRProof(root, hashes[i], proof))
+
+			//a proof does not hold for another leaf or index
+			assert.Error(VerifyMMRProof(root, hashes[(i+1)%len(hashes)], proof))
+			proof.Index = uint32((i + 1) % n)
+			if n > 1 {
+				assert.Error(VerifyMMRProof(root, hashes[i], proof))
+			}
+		}
+
+		_, err := mmr.Proof(uint32(n))
+		assert.Error(err)
+	}
+}
+
+func TestMergeMMR_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	hashes := mmrHashes(11)
+	//appending a leaf, merging equal sizes and merging a smaller tail
+	for _, v := range []struct{ first, second int }{{1, 1}, {6, 1}, {7, 1}, {4, 4}, {8, 3}, {6, 2}} {
+		assignment := newMergeMMRAssignment(hashes[:v.first+v.second], v.first)
+		err := test.IsSolved(&mergeMMRCircuit{}, assignment, ecc.BN254.ScalarField())
+		assert.NoError(err, "%v+%v", v.first, v.second)
+	}
+
+	//the leaves of the second MMR must line up with the subtrees of the first
+	for _, v := range []struct{ first, second int }{{5, 2}, {2, 4}, {6, 4}} {
+		assignment := newMergeMMRAssignment(hashes[:v.first+v.second], v.first)
+		err := test.IsSolved(&mergeMMRCircuit{}, assignment, ecc.BN254.ScalarField())
+		assert.Error(err, "%v+%v", v.first, v.second)
+	}
+}
+
+func TestMMR_Merge(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	hashes := mmrHashes(13)
+	for n := 1; n <= len(hashes); n++ {
+		for first := 0; first <= n; first++ {
+			expected := NewMMR(hashes[:n]).Root()
+			aligned := first == n || first%(1<<(bits.Len(uint(n-first))-1)) == 0
+
+			merged, err := NewMMR(hashes[:first]).Merge(NewMMR(hashes[first:n]))
+			if !aligned {
+				assert.Error(err, "%v+%v", first, n-first)
+				continue
+			}
+			assert.NoError(err, "%v+%v", first, n-first)
+			assert.Equal(expected, merged.Root(), "%v+%v", first, n-first)
+
+			//the peaks alone are enough to merge
+			pruned, err := MMRFromPeaks(uint32(first), NewMMR(hashes[:first]).Peaks())
+			assert.NoError(err)
+			merged, err = pruned.Merge(NewMMR(hashes[first:n]))
+			assert.NoError(err)
+			assert.Equal(expected, merged.Root(), "%v+%v", first, n-first)
+		}
+	}
+}
+
+func TestMMR_JSON(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	hashes := mmrHashes(11)
+	mmr := NewMMR(hashes[:10])
+	data, err := json.Marshal(mmr)
+	assert.NoError(err)
+
+	var restored MMR
+	assert.NoError(json.Unmarshal(data, &restored))
+	assert.Equal(mmr.Count(), restored.Count())
+	assert.Equal(mmr.Root(), restored.Root())
+
+	//a restored MMR grows like the original but proves nothing
+	mmr.Append(hashes[10])
+	restored.Append(hashes[10])
+	assert.Equal(mmr.Root(), restored.Root())
+	_, err = restored.Proof(0)
+	assert.Error(err)
+}
@@ -0,0 +1,153 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"math/big"
+)
+
+// Network holds the consensus parameters of a Bitcoin network that matter for validating headers.
+// The parameters are compiled into the circuits, every network has its own ccs and keys.
+type Network struct {
+	Name                         string
+	Magic                        [4]byte //message start of the p2p protocol, also precedes every block in blk*.dat files
+	DefaultPort                  uint16
+	GenesisHash                  chainhash.Hash
+	GenesisTime                  uint32
+	GenesisBits                  uint32
+	PowLimit                     *big.Int
+	PowLimitBits                 uint32
+	DifficultyAdjustmentInterval uint32
+	PowTargetTimespan            int64
+	PowTargetSpacing             int64
+	AllowMinDifficultyBlocks     bool //a block more than twice the target spacing after its parent may have the pow limit as target
+	NoRetargeting                bool //nBits never changes
+	EnforceBIP94                 bool //retarget from the first block of the epoch and restrict the time warp
+}
+
+// BIP94 restricts how far the first block of an epoch may be dated before its parent.
+const MaxTimewarp = 600
+
+func newHash(s string) chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(s)
+	if err != nil {
+		panic(err)
+	}
+	return *hash
+}
+
+func newBig(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic(fmt.Sprintf("invalid hex %v", s))
+	}
+	return v
+}
+
+var MainNet = &Network{
+	Name:                         "mainnet",
+	Magic:                        [4]byte{0xf9, 0xbe, 0xb4, 0xd9},
+	DefaultPort:                  8333,
+	GenesisHash:                  newHash("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"),
+	GenesisTime:                  1231006505,
+	GenesisBits:                  0x1d00ffff,
+	PowLimit:                     newBig("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	PowLimitBits:                 0x1d00ffff,
+	DifficultyAdjustmentInterval: 2016,
+	PowTargetTimespan:            14 * 24 * 60 * 60,
+	PowTargetSpacing:             10 * 60,
+}
+
+var TestNet3 = &Network{
+	Name:                         "testnet3",
+	Magic:                        [4]byte{0x0b, 0x11, 0x09, 0x07},
+	DefaultPort:                  18333,
+	GenesisHash:                  newHash("000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"),
+	GenesisTime:                  1296688602,
+	GenesisBits:                  0x1d00ffff,
+	PowLimit:                     newBig("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	PowLimitBits:                 0x1d00ffff,
+	DifficultyAdjustmentInterval: 2016,
+	PowTargetTimespan:            14 * 24 * 60 * 60,
+	PowTargetSpacing:             10 * 60,
+	AllowMinDifficultyBlocks:     true,
+}
+
+var TestNet4 = &Network{
+	Name:                         "testnet4",
+	Magic:                        [4]byte{0x1c, 0x16, 0x3f, 0x28},
+	DefaultPort:                  48333,
+	GenesisHash:                  newHash("00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043"),
+	GenesisTime:                  1714777860,
+	GenesisBits:                  0x1d00ffff,
+	PowLimit:                     newBig("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	PowLimitBits:                 0x1d00ffff,
+	DifficultyAdjustmentInterval: 2016,
+	PowTargetTimespan:            14 * 24 * 60 * 60,
+	PowTargetSpacing:             10 * 60,
+	AllowMinDifficultyBlocks:     true,
+	EnforceBIP94:                 true,
+}
+
+// SigNet is the default signet. The block signatures of signet live in the coinbase and are not
+// validated by the header circuits.
+var SigNet = &Network{
+	Name:                         "signet",
+	Magic:                        [4]byte{0x0a, 0x03, 0xcf, 0x40},
+	DefaultPort:                  38333,
+	GenesisHash:                  newHash("00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"),
+	GenesisTime:                  1598918400,
+	GenesisBits:                  0x1e0377ae,
+	PowLimit:                     newBig("00000377ae000000000000000000000000000000000000000000000000000000"),
+	PowLimitBits:                 0x1e0377ae,
+	DifficultyAdjustmentInterval: 2016,
+	PowTargetTimespan:            14 * 24 * 60 * 60,
+	PowTargetSpacing:             10 * 60,
+}
+
+var RegTest = &Network{
+	Name:                         "regtest",
+	Magic:                        [4]byte{0xfa, 0xbf, 0xb5, 0xda},
+	DefaultPort:                  18444,
+	GenesisHash:                  newHash("0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"),
+	GenesisTime:                  1296688602,
+	GenesisBits:                  0x207fffff,
+	PowLimit:                     newBig("7fffff0000000000000000000000000000000000000000000000000000000000"),
+	PowLimitBits:                 0x207fffff,
+	DifficultyAdjustmentInterval: 2016,
+	PowTargetTimespan:            14 * 24 * 60 * 60,
+	PowTargetSpacing:             10 * 60,
+	AllowMinDifficultyBlocks:     true,
+	NoRetargeting:                true,
+}
+
+var Networks = []*Network{MainNet, TestNet3, TestNet4, SigNet, RegTest}
+
+func NetworkByName(name string) (*Network, error) {
+	for _, net := range Networks {
+		if net.Name == name {
+			return net, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %v", name)
+}
+
+// GenesisState returns the consensus state after the genesis block. Bitcoin Core takes the median
+// time past of the first blocks over fewer than MedianTimeSpan timestamps, the padding keeps the
+// median of the window equal to theirs until it is filled with real timestamps.
+func (net *Network) GenesisState() NativeChainState {
+	state := NativeChainState{
+		EpochBits:      net.GenesisBits,
+		EpochStartTime: net.GenesisTime,
+		Bits:           net.GenesisBits,
+	}
+	for i := 0; i < MedianTimeSpan-1; i++ {
+		if i%2 == 0 {
+			state.Timestamps[i] = 0
+		} else {
+			state.Timestamps[i] = 0xffffffff
+		}
+	}
+	state.Timestamps[MedianTimeSpan-1] = net.GenesisTime
+	return state
+}
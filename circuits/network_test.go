@@ -0,0 +1,185 @@
+package circuits
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"slices"
+	"testing"
+)
+
+var genesisHeaders = map[*Network]string{
+	MainNet:  "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c",
+	TestNet3: "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff001d1aa4ae18",
+	RegTest:  "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff7f2002000000",
+}
+
+type nextChainStateCircuit struct {
+	Height  frontend.Variable
+	State   ChainState
+	Header  [BlockHeaderLen]uints.U8
+	Next    ChainState
+	Network *Network `gnark:"-"`
+}
+
+func (c *nextChainStateCircuit) Define(api frontend.API) error {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return err
+	}
+
+	compact := DecodeCompact(api, f, [BitsLen]uints.U8(c.Header[BitsOffset:BitsOffset+BitsLen]))
+	assertWithinPowLimit(api, f, c.Network, compact)
+	next, err := NextChainState(api, c.Network, c.Height, c.State, c.Header[:], compact)
+	if err != nil {
+		return err
+	}
+	next.AssertIsEqual(api, c.Next)
+	return nil
+}
+
+// isNextChainState checks natively and in circuit whether header is valid at height on top of state.
+func isNextChainState(assert *test.Assert, net *Network, state NativeChainState, height uint32, header [BlockHeaderLen]byte) bool {
+	next, nativeErr := state.Next(net, height, header)
+
+	assignment := &nextChainStateCircuit{
+		Height: height - 1,
+		State:  ChainStateFromNative(state),
+		Header: [BlockHeaderLen]uints.U8(uints.NewU8Array(header[:])),
+		Next:   ChainStateFromNative(next),
+	}
+	circuitErr := test.IsSolved(&nextChainStateCircuit{Network: net}, assignment, ecc.BN254.ScalarField())
+	assert.Equal(nativeErr == nil, circuitErr == nil, "native: %v, circuit: %v", nativeErr, circuitErr)
+	return nativeErr == nil
+}
+
+func newHeader(bits, time uint32) [BlockHeaderLen]byte {
+	var header [BlockHeaderLen]byte
+	binary.LittleEndian.PutUint32(header[BitsOffset:], bits)
+	binary.LittleEndian.PutUint32(header[TimestampOffset:], time)
+	return header
+}
+
+func TestNetwork_Genesis(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for net, h := range genesisHeaders {
+		header, err := hex.DecodeString(h)
+		assert.NoError(err)
+		assert.Equal(net.GenesisHash, chainhash.DoubleHashH(header), net.Name)
+		assert.Equal(net.GenesisTime, binary.LittleEndian.Uint32(header[TimestampOffset:]), net.Name)
+		assert.Equal(net.GenesisBits, binary.LittleEndian.Uint32(header[BitsOffset:]), net.Name)
+		assert.NoError(CheckProofOfWork(net, [BlockHeaderLen]byte(header)), net.Name)
+	}
+
+	for _, net := range Networks {
+		found, err := NetworkByName(net.Name)
+		assert.NoError(err)
+		assert.Equal(net, found)
+
+		target, err := CompactToTarget(net.PowLimitBits)
+		assert.NoError(err)
+		assert.Equal(net.PowLimitBits, TargetToCompact(net.PowLimit), net.Name)
+		assert.True(target.Cmp(net.PowLimit) <= 0, net.Name)
+	}
+	_, err := NetworkByName("testnet")
+	assert.Error(err)
+}
+
+// the median time past of the padded genesis state matches the one Bitcoin Core takes over the
+// fewer than MedianTimeSpan blocks available
+func TestNetwork_GenesisState(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	state := MainNet.GenesisState()
+	times := []uint32{MainNet.GenesisTime}
+	for height := uint32(1); height <= MedianTimeSpan+1; height++ {
+		sorted := slices.Clone(times[max(0, len(times)-MedianTimeSpan):])
+		slices.Sort(sorted)
+		assert.Equal(sorted[len(sorted)/2], state.MedianTimePast(), "height %v", height)
+
+		//times going back and forth around the median
+		time := sorted[len(sorted)/2] + 1 + (height%3)*1000
+		var err error
+		state, err = state.Next(MainNet, height, newHeader(MainNet.GenesisBits, time))
+		assert.NoError(err)
+		times = append(times, time)
+	}
+}
+
+func TestNetwork_MinDifficultyBlocks(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const time = 1700000000
+	state := NativeChainState{EpochBits: 0x1c0fffff, EpochStartTime: time - 6000, Bits: 0x1c0fffff, Timestamps: timestampsUntil(time)}
+
+	//a block more than 20 minutes late falls back to the pow limit on testnet only
+	assert.True(isNextChainState(assert, TestNet3, state, 1001, newHeader(TestNet3.PowLimitBits, time+1201)))
+	assert.False(isNextChainState(assert, TestNet3, state, 1001, newHeader(TestNet3.PowLimitBits, time+1200)))
+	assert.False(isNextChainState(assert, MainNet, state, 1001, newHeader(MainNet.PowLimitBits, time+1201)))
+	assert.False(isNextChainState(assert, TestNet3, state, 1001, newHeader(0x1c0ffffe, time+1201)))
+	assert.False(isNextChainState(assert, TestNet3, state, 1001, newHeader(0x1c0fffff, time+1201)))
+	assert.True(isNextChainState(assert, TestNet3, state, 1001, newHeader(0x1c0fffff, time+1200)))
+	assert.True(isNextChainState(assert, MainNet, state, 1001, newHeader(0x1c0fffff, time+1201)))
+
+	//the next block returns to the difficulty of the epoch
+	next, err := state.Next(TestNet3, 1001, newHeader(TestNet3.PowLimitBits, time+1201))
+	assert.NoError(err)
+	assert.Equal(uint32(0x1c0fffff), next.EpochBits)
+	assert.Equal(TestNet3.PowLimitBits, next.Bits)
+	assert.True(isNextChainState(assert, TestNet3, next, 1002, newHeader(0x1c0fffff, time+1300)))
+	assert.False(isNextChainState(assert, TestNet3, next, 1002, newHeader(TestNet3.PowLimitBits, time+1300)))
+}
+
+func TestNetwork_PowLimit(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	const time = 1700000000
+	state := NativeChainState{EpochBits: 0x2000ffff, EpochStartTime: time - 6000, Bits: 0x2000ffff, Timestamps: timestampsUntil(time)}
+
+	//a state carrying a target above the pow limit can not be extended
+	assert.False(isNextChainState(assert, MainNet, state, 1001, newHeader(0x2000ffff, time+600)))
+	assert.True(isNextChainState(assert, RegTest, state, 1001, newHeader(0x2000ffff, time+600)))
+}
+
+func TestNetwork_Retarget(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	//the last block of the epoch was mined at the minimum difficulty
+	const time = 1700000000
+	state := NativeChainState{EpochBits: 0x1c0fffff, EpochStartTime: time - uint32(MainNet.PowTargetTimespan), Bits: TestNet3.PowLimitBits, Timestamps: timestampsUntil(time)}
+
+	//testnet3 retargets from the last block, testnet4 from the first block of the epoch
+	testnet3Bits, err := TestNet3.CalculateNextWorkRequired(TestNet3.PowLimitBits, int64(state.EpochStartTime), time)
+	assert.NoError(err)
+	testnet4Bits, err := TestNet4.CalculateNextWorkRequired(0x1c0fffff, int64(state.EpochStartTime), time)
+	assert.NoError(err)
+	assert.Equal(uint32(0x1d00ffff), testnet3Bits)
+	assert.Equal(uint32(0x1c0fffff), testnet4Bits)
+
+	assert.True(isNextChainState(assert, TestNet3, state, 4032, newHeader(testnet3Bits, time+600)))
+	assert.False(isNextChainState(assert, TestNet3, state, 4032, newHeader(testnet4Bits, time+600)))
+	assert.True(isNextChainState(assert, TestNet4, state, 4032, newHeader(testnet4Bits, time+600)))
+	assert.False(isNextChainState(assert, TestNet4, state, 4032, newHeader(testnet3Bits, time+600)))
+
+	//BIP94 forbids dating the first block of an epoch more than 10 minutes before its parent
+	state.Timestamps = timestampsUntil(time + 5000)
+	state.Timestamps[MedianTimeSpan-1] = time + 6000
+	testnet3Bits, err = TestNet3.CalculateNextWorkRequired(TestNet3.PowLimitBits, int64(state.EpochStartTime), time+6000)
+	assert.NoError(err)
+	testnet4Bits, err = TestNet4.CalculateNextWorkRequired(0x1c0fffff, int64(state.EpochStartTime), time+6000)
+	assert.NoError(err)
+	assert.True(isNextChainState(assert, TestNet4, state, 4032, newHeader(testnet4Bits, time+5400)))
+	assert.False(isNextChainState(assert, TestNet4, state, 4032, newHeader(testnet4Bits, time+5399)))
+	assert.True(isNextChainState(assert, TestNet3, state, 4032, newHeader(testnet3Bits, time+5399)))
+
+	//regtest never retargets
+	state = RegTest.GenesisState()
+	assert.True(isNextChainState(assert, RegTest, state, 2016, newHeader(RegTest.PowLimitBits, RegTest.GenesisTime+1)))
+	assert.False(isNextChainState(assert, RegTest, state, 2016, newHeader(0x2000ffff, RegTest.GenesisTime+1)))
+}
@@ -0,0 +1,191 @@
+package circuits
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/std/rangecheck"
+	"math/big"
+)
+
+const BitsOffset = 72
+const BitsLen = 4
+
+// the compact exponent is restricted so that the decoded target always fits in 256 bits and is
+// at least 2^128, which keeps the work of a single block below 2^128
+const MinCompactExponent = 19
+const MaxCompactExponent = HashLen
+
+// AssertProofOfWork decodes the nBits field of header, asserts that the target does not exceed the
+// proof of work limit of net and that the block hash, read as a little-endian 256-bit integer, does
+// not exceed the target. It returns the decoded nBits field.
+func AssertProofOfWork(api frontend.API, net *Network, header []uints.U8, hash Hash) (*Compact, error) {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return nil, err
+	}
+
+	compact := DecodeCompact(api, f, [BitsLen]uints.U8(header[BitsOffset:BitsOffset+BitsLen]))
+	assertWithinPowLimit(api, f, net, compact)
+
+	hashVal := BigIntFromBytes(api, f, hash[:])
+	api.AssertIsEqual(bigIntIsLessOrEqual(api, f, hashVal, compact.Target), 1)
+	return compact, nil
+}
+
+// WorkFromTarget returns floor(2^256 / (target+1)), the expected number of hashes needed to
+// meet target. The target must come from DecodeCompact so that the result fits in 128 bits.
+func WorkFromTarget(api frontend.API, target *BigInt) (frontend.Variable, error) {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return nil, err
+	}
+
+	//work < 2^128, hence work*(target+1) + rem stays far below the emulated modulus
+	work, _, err := bigIntDivRem(api, f, bigIntConstant(new(big.Int).Lsh(big.NewInt(1), 256)), f.Add(target, f.One()), 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.Add(work.Limbs[0], api.Mul(work.Limbs[1], new(big.Int).Lsh(big.NewInt(1), 64))), nil
+}
+
+// Compact is an in-circuit decoded compact (nBits) target.
+type Compact struct {
+	Mantissa frontend.Variable
+	Target   *BigInt //Mantissa * 256^(exponent-3)
+	Unit     *BigInt //256^(exponent-3), the precision of Target
+}
+
+// DecodeCompact decodes a compact (nBits) encoded target, given in little-endian byte order.
+// The mantissa must be non-zero with the sign bit cleared and the exponent must lie in
+// [MinCompactExponent, MaxCompactExponent].
+func DecodeCompact(api frontend.API, f *emulated.Field[BigIntParams], bits [BitsLen]uints.U8) *Compact {
+	rcheck := rangecheck.New(api)
+	mantissa := [3]frontend.Variable{bits[0].Val, bits[1].Val, bits[2].Val}
+	exponent := bits[3].Val
+	rcheck.Check(mantissa[0], 8)
+	rcheck.Check(mantissa[1], 8)
+	rcheck.Check(mantissa[2], 7) //sign bit must be cleared
+	rcheck.Check(exponent, 8)
+
+	mantissaVal := api.Add(mantissa[0], api.Mul(mantissa[1], 1<<8), api.Mul(mantissa[2], 1<<16))
+	api.AssertIsDifferent(mantissaVal, 0)
+
+	//shift[k] == 1 iff the mantissa is shifted left by k bytes
+	shift := make([]frontend.Variable, HashLen-2)
+	sum := frontend.Variable(0)
+	for k := range shift {
+		if k+3 < MinCompactExponent || k+3 > MaxCompactExponent {
+			shift[k] = 0
+			continue
+		}
+		shift[k] = api.IsZero(api.Sub(exponent, k+3))
+		sum = api.Add(sum, shift[k])
+	}
+	api.AssertIsEqual(sum, 1)
+
+	targetBytes := make([]frontend.Variable, HashLen)
+	unitBytes := make([]frontend.Variable, HashLen)
+	for i := 0; i < HashLen; i++ {
+		targetBytes[i] = frontend.Variable(0)
+		for j := 0; j < len(mantissa); j++ {
+			if i-j >= 0 && i-j < len(shift) {
+				targetBytes[i] = api.Add(targetBytes[i], api.Mul(mantissa[j], shift[i-j]))
+			}
+		}
+		unitBytes[i] = frontend.Variable(0)
+		if i < len(shift) {
+			unitBytes[i] = shift[i]
+		}
+	}
+
+	return &Compact{
+		Mantissa: mantissaVal,
+		Target:   bigIntFromVars(api, f, targetBytes),
+		Unit:     bigIntFromVars(api, f, unitBytes),
+	}
+}
+
+// CompactToTarget is the native counterpart of DecodeCompact, it rejects exactly the
+// encodings the circuit rejects.
+func CompactToTarget(bits uint32) (*big.Int, error) {
+	exponent := bits >> 24
+	mantissa := bits & 0x007fffff
+	if bits&0x00800000 != 0 {
+		return nil, fmt.Errorf("negative compact target %08x", bits)
+	}
+	if mantissa == 0 {
+		return nil, fmt.Errorf("zero compact target %08x", bits)
+	}
+	if exponent < MinCompactExponent || exponent > MaxCompactExponent {
+		return nil, fmt.Errorf("compact target %08x exponent out of range", bits)
+	}
+
+	target := new(big.Int).SetUint64(uint64(mantissa))
+	return target.Lsh(target, uint(8*(exponent-3))), nil
+}
+
+// CalcWork is the native counterpart of WorkFromTarget, it returns the work represented by
+// a compact encoded target.
+func CalcWork(bits uint32) (*big.Int, error) {
+	target, err := CompactToTarget(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	target.Add(target, big.NewInt(1))
+	return target.Div(new(big.Int).Lsh(big.NewInt(1), 256), target), nil
+}
+
+// HeaderWork returns the work represented by the nBits field of header.
+func HeaderWork(header [BlockHeaderLen]byte) (*big.Int, error) {
+	return CalcWork(binary.LittleEndian.Uint32(header[BitsOffset:]))
+}
+
+// HashToBig interprets a hash in internal byte order as a little-endian 256-bit integer.
+func HashToBig(hash [HashLen]byte) *big.Int {
+	reversed := make([]byte, HashLen)
+	for i := 0; i < HashLen; i++ {
+		reversed[i] = hash[HashLen-1-i]
+	}
+	return new(big.Int).SetBytes(reversed)
+}
+
+// assertWithinPowLimit asserts that the target of compact does not exceed the proof of work limit
+// of net.
+func assertWithinPowLimit(api frontend.API, f *emulated.Field[BigIntParams], net *Network, compact *Compact) {
+	api.AssertIsEqual(bigIntIsLessOrEqual(api, f, compact.Target, bigIntConstant(net.PowLimit)), 1)
+}
+
+// CheckTarget natively checks that bits decodes to a target within the proof of work limit of net.
+func (net *Network) CheckTarget(bits uint32) (*big.Int, error) {
+	target, err := CompactToTarget(bits)
+	if err != nil {
+		return nil, err
+	}
+	if target.Cmp(net.PowLimit) > 0 {
+		return nil, fmt.Errorf("compact target %08x above the %v proof of work limit", bits, net.Name)
+	}
+	return target, nil
+}
+
+// CheckProofOfWork natively checks that the hash of header satisfies its nBits target, which must
+// be within the proof of work limit of net. Headers rejected here can not be proven by
+// BlockHeaderUnitCircuit.
+func CheckProofOfWork(net *Network, header [BlockHeaderLen]byte) error {
+	bits := binary.LittleEndian.Uint32(header[BitsOffset:])
+	target, err := net.CheckTarget(bits)
+	if err != nil {
+		return err
+	}
+
+	hash := chainhash.DoubleHashH(header[:])
+	if HashToBig(hash).Cmp(target) > 0 {
+		return fmt.Errorf("block %v hash above target %08x", hash, bits)
+	}
+	return nil
+}
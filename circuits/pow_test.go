@@ -0,0 +1,187 @@
+package circuits
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/std/math/emulated"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"math/big"
+	"testing"
+)
+
+func TestCompactToTarget(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	target, err := CompactToTarget(0x1d00ffff)
+	assert.NoError(err)
+	assert.Equal("ffff0000000000000000000000000000000000000000000000000000", target.Text(16))
+
+	_, err = CompactToTarget(0x1d80ffff) //sign bit
+	assert.Error(err)
+	_, err = CompactToTarget(0x1d000000) //zero mantissa
+	assert.Error(err)
+	_, err = CompactToTarget(0x2100ffff) //overflow
+	assert.Error(err)
+	_, err = CompactToTarget(0x0200ffff) //exponent too small
+	assert.Error(err)
+}
+
+type decodeCompactCircuit struct {
+	Bits   [BitsLen]uints.U8
+	Target BigInt
+}
+
+func (c *decodeCompactCircuit) Define(api frontend.API) error {
+	f, err := emulated.NewField[BigIntParams](api)
+	if err != nil {
+		return err
+	}
+
+	compact := DecodeCompact(api, f, c.Bits)
+	f.AssertIsEqual(compact.Target, &c.Target)
+	return nil
+}
+
+func TestDecodeCompact(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, bits := range []uint32{0x1d00ffff, 0x1b0404cb, 0x207fffff, 0x137fffff, 0x0300ffff, 0x1d80ffff, 0x1d000000, 0x2100ffff, 0x1200ffff} {
+		var bitsBytes [BitsLen]byte
+		binary.LittleEndian.PutUint32(bitsBytes[:], bits)
+
+		//the mantissa shifted by the exponent, whether or not the encoding is accepted
+		target := new(big.Int).Lsh(big.NewInt(int64(bits&0x00ffffff)), 8*uint(bits>>24-3))
+		_, nativeErr := CompactToTarget(bits)
+
+		assignment := &decodeCompactCircuit{
+			Bits:   [BitsLen]uints.U8(uints.NewU8Array(bitsBytes[:])),
+			Target: emulated.ValueOf[BigIntParams](target),
+		}
+		circuitErr := test.IsSolved(&decodeCompactCircuit{}, assignment, ecc.BN254.ScalarField())
+		assert.Equal(nativeErr == nil, circuitErr == nil, "%08x native: %v, circuit: %v", bits, nativeErr, circuitErr)
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	work, err := CalcWork(0x1d00ffff)
+	assert.NoError(err)
+	assert.Equal("100010001", work.Text(16))
+
+	work, err = CalcWork(0x1b0404cb)
+	assert.NoError(err)
+	assert.Equal("3fb3ab764c00", work.Text(16))
+}
+
+type proofOfWorkCircuit struct {
+	Header  [BlockHeaderLen]uints.U8
+	Hash    Hash
+	Network *Network `gnark:"-"`
+}
+
+func (c *proofOfWorkCircuit) Define(api frontend.API) error {
+	_, err := AssertProofOfWork(api, c.Network, c.Header[:], c.Hash)
+	return err
+}
+
+// isProofOfWork checks natively and in circuit whether header meets its target on net.
+func isProofOfWork(assert *test.Assert, net *Network, header [BlockHeaderLen]byte) bool {
+	nativeErr := CheckProofOfWork(net, header)
+
+	hash := chainhash.DoubleHashH(header[:])
+	assignment := &proofOfWorkCircuit{
+		Header: [BlockHeaderLen]uints.U8(uints.NewU8Array(header[:])),
+		Hash:   Hash(uints.NewU8Array(hash[:])),
+	}
+	circuitErr := test.IsSolved(&proofOfWorkCircuit{Network: net}, assignment, ecc.BN254.ScalarField())
+	assert.Equal(nativeErr == nil, circuitErr == nil, "native: %v, circuit: %v", nativeErr, circuitErr)
+	return nativeErr == nil
+}
+
+// mineHeader returns the header h with its nBits field set to bits and a nonce meeting the target.
+func mineHeader(assert *test.Assert, h string, bits uint32) [BlockHeaderLen]byte {
+	header, err := hex.DecodeString(h)
+	assert.NoError(err)
+	binary.LittleEndian.PutUint32(header[BitsOffset:], bits)
+	target, err := CompactToTarget(bits)
+	assert.NoError(err)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(header[76:], nonce)
+		hash := chainhash.DoubleHashH(header)
+		if HashToBig(hash).Cmp(target) <= 0 {
+			return [BlockHeaderLen]byte(header)
+		}
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, h := range headers {
+		header, err := hex.DecodeString(h)
+		assert.NoError(err)
+		assert.True(isProofOfWork(assert, MainNet, [80]byte(header)))
+	}
+
+	header, err := hex.DecodeString(headers[0])
+	assert.NoError(err)
+	header[76] ^= 0xff //nonce
+	assert.False(isProofOfWork(assert, MainNet, [80]byte(header)))
+
+	//a target above the pow limit of the network
+	easy := mineHeader(assert, headers[0], RegTest.PowLimitBits)
+	assert.True(isProofOfWork(assert, RegTest, easy))
+	assert.False(isProofOfWork(assert, MainNet, easy))
+	_, err = MainNet.CheckTarget(0x1d010000)
+	assert.Error(err)
+	_, err = MainNet.CheckTarget(MainNet.PowLimitBits)
+	assert.NoError(err)
+}
+
+func TestBlockHeaderUnitCircuit_PoW_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	vkFpBytes := make([]byte, 32)
+	circuit := NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, ByteLayout)
+
+	header, err := hex.DecodeString(headers[0])
+	assert.NoError(err)
+	hash := chainhash.DoubleHashH(header)
+	assignment, err := NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, [80]byte(header), 0, beginState, vkFpBytes, ByteLayout)
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//wrong chain work
+	assignment.(*BlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]).ChainWork = 0x100010002
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//same header with a nonce that misses the target
+	header[76] ^= 0xff
+	hash = chainhash.DoubleHashH(header)
+	assignment, err = NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, [80]byte(header), 0, beginState, vkFpBytes, ByteLayout)
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//a begin state claiming an epoch target above the pow limit
+	easy := mineHeader(assert, headers[0], RegTest.PowLimitBits)
+	hash = chainhash.DoubleHashH(easy[:])
+	easyState := beginState
+	easyState.EpochBits, easyState.Bits = RegTest.PowLimitBits, RegTest.PowLimitBits
+	_, err = NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, hash, easy, 0, easyState, vkFpBytes, ByteLayout)
+	assert.Error(err)
+	assignment, err = NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](RegTest, hash, easy, 0, easyState, vkFpBytes, ByteLayout)
+	assert.NoError(err)
+	err = test.IsSolved(NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](RegTest, ByteLayout), assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	err = test.IsSolved(circuit, assignment, ecc.BN254.ScalarField())
+	assert.Error(err)
+}
@@ -0,0 +1,131 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+)
+
+// NbPublicVariables is the number of public variables of the unit, batch and recursive circuits in
+// the byte layout.
+const NbPublicVariables = VkFpIndex + 1
+
+// Version of the circuits, to be bumped whenever a change of the constraints or the public layout
+// makes earlier proofs and artifacts incompatible.
+const Version = 2
+
+// PublicWitness is the native view of the public variables shared by the unit, batch and recursive
+// circuits in either layout. Hashes are in internal byte order.
+type PublicWitness struct {
+	Layout      Layout
+	BeginHash   [HashLen]byte
+	EndHash     [HashLen]byte
+	ChainWork   *big.Int
+	BeginHeight uint32
+	Count       uint32
+	BeginState  NativeChainState
+	EndState    NativeChainState
+	MMRRoot     fr.Element
+	VkFp        utils.FingerPrintBytes
+}
+
+// EndHeight returns the height of the last header of the range.
+func (w *PublicWitness) EndHeight() uint32 {
+	return w.BeginHeight + w.Count
+}
+
+// DecodePublicWitness decodes the public part of a witness of the unit, batch or recursive circuit.
+func DecodePublicWitness(wit witness.Witness) (*PublicWitness, error) {
+	public, err := wit.Public()
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := public.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("witness is not over bn254")
+	}
+	layout, err := LayoutOf(len(vec))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &PublicWitness{Layout: layout}
+	ret.BeginHash, err = hashOf(layout, vec[layout.BeginHashIndex():])
+	if err != nil {
+		return nil, err
+	}
+	ret.EndHash, err = hashOf(layout, vec[layout.EndHashIndex():])
+	if err != nil {
+		return nil, err
+	}
+	ret.ChainWork = vec[layout.ChainWorkIndex()].BigInt(new(big.Int))
+	ret.BeginHeight, err = uint32Of(vec[layout.BeginHeightIndex()])
+	if err != nil {
+		return nil, err
+	}
+	ret.Count, err = uint32Of(vec[layout.CountIndex()])
+	if err != nil {
+		return nil, err
+	}
+	ret.BeginState, err = nativeChainStateOf(vec[layout.BeginStateIndex() : layout.BeginStateIndex()+ChainStateLen])
+	if err != nil {
+		return nil, err
+	}
+	ret.EndState, err = nativeChainStateOf(vec[layout.EndStateIndex() : layout.EndStateIndex()+ChainStateLen])
+	if err != nil {
+		return nil, err
+	}
+	ret.MMRRoot = vec[layout.MMRRootIndex()]
+	vkFp := vec[layout.VkFpIndex()].Bytes()
+	ret.VkFp = vkFp[:]
+	return ret, nil
+}
+
+// hashOf decodes the hash at the start of vec in layout.
+func hashOf(layout Layout, vec fr.Vector) ([HashLen]byte, error) {
+	if layout.Packed {
+		return UnpackHash([PackedHashLen]fr.Element(vec[:PackedHashLen]))
+	}
+
+	var hash [HashLen]byte
+	for i := range hash {
+		var err error
+		hash[i], err = uint8Of(vec[i])
+		if err != nil {
+			return hash, err
+		}
+	}
+	return hash, nil
+}
+
+// nativeChainStateOf follows the field order of ChainState.
+func nativeChainStateOf(vec fr.Vector) (NativeChainState, error) {
+	var vals [ChainStateLen]uint32
+	for i := range vals {
+		var err error
+		vals[i], err = uint32Of(vec[i])
+		if err != nil {
+			return NativeChainState{}, err
+		}
+	}
+
+	state := NativeChainState{EpochBits: vals[0], EpochStartTime: vals[1], Bits: vals[2]}
+	copy(state.Timestamps[:], vals[3:])
+	return state, nil
+}
+
+func uint8Of(e fr.Element) (uint8, error) {
+	if !e.IsUint64() || e.Uint64() > 0xff {
+		return 0, fmt.Errorf("public variable %v is not a byte", e.String())
+	}
+	return uint8(e.Uint64()), nil
+}
+
+func uint32Of(e fr.Element) (uint32, error) {
+	if !e.IsUint64() || e.Uint64() > 0xffffffff {
+		return 0, fmt.Errorf("public variable %v is not a 32-bit value", e.String())
+	}
+	return uint32(e.Uint64()), nil
+}
@@ -0,0 +1,58 @@
+package circuits
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"testing"
+)
+
+func TestDecodePublicWitness(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	blockHeaders := make([][BlockHeaderLen]byte, len(headers))
+	hashes := make([][HashLen]byte, len(headers))
+	for i, h := range headers {
+		header, err := hex.DecodeString(h)
+		assert.NoError(err)
+		blockHeaders[i] = [BlockHeaderLen]byte(header)
+		hashes[i] = chainhash.DoubleHashH(header)
+	}
+
+	vkFp := make([]byte, 32)
+	vkFp[31] = 0x2a
+
+	assignment, err := NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](MainNet, blockHeaders, 0, beginState, vkFp, ByteLayout)
+	assert.NoError(err)
+
+	wit, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	assert.NoError(err)
+
+	decoded, err := DecodePublicWitness(wit)
+	assert.NoError(err)
+
+	assert.Equal([HashLen]byte(blockHeaders[0][BeginHashOffset:BeginHashOffset+HashLen]), decoded.BeginHash)
+	assert.Equal(hashes[len(hashes)-1], decoded.EndHash)
+	assert.Equal(uint32(0), decoded.BeginHeight)
+	assert.Equal(uint32(len(headers)), decoded.Count)
+	assert.Equal(uint32(len(headers)), decoded.EndHeight())
+	assert.Equal(beginState, decoded.BeginState)
+	assert.Equal([]byte(vkFp), []byte(decoded.VkFp))
+
+	state := beginState
+	for i, header := range blockHeaders {
+		state, err = state.Next(MainNet, uint32(i)+1, header)
+		assert.NoError(err)
+	}
+	assert.Equal(state, decoded.EndState)
+
+	mmrRoot := NewMMR(hashes).Root()
+	assert.True(mmrRoot.Equal(&decoded.MMRRoot))
+
+	work, err := HeaderWork(blockHeaders[0])
+	assert.NoError(err)
+	assert.Equal(int64(len(headers))*work.Int64(), decoded.ChainWork.Int64())
+}
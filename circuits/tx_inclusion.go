@@ -0,0 +1,190 @@
+package circuits
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/math/cmp"
+	"github.com/consensys/gnark/std/math/uints"
+	"math/big"
+)
+
+const MerkleRootOffset = BeginHashOffset + HashLen
+
+// TxInclusionCircuit proves that TxId is a leaf of the Merkle tree committed to by the block with
+// hash BlockHash. The branch holds up to len(Branch) siblings, Depth of which are used.
+//
+// Depth is public since an inner node of the tree is 64 bytes and could pass for the txid of a
+// 64-byte transaction at a smaller depth; verifiers should check it against the transaction count of
+// the block.
+type TxInclusionCircuit struct {
+	BlockHash   Hash              `gnark:",public"`
+	TxId        Hash              `gnark:",public"`
+	Depth       frontend.Variable `gnark:",public"`
+	BlockHeader [BlockHeaderLen]uints.U8
+	Branch      []Hash
+	Index       frontend.Variable //position of the transaction in the block
+}
+
+func (c *TxInclusionCircuit) Define(api frontend.API) error {
+	maxDepth := len(c.Branch)
+
+	hash, err := DoubleSha256(api, c.BlockHeader[:])
+	if err != nil {
+		return err
+	}
+	hash.AssertIsEqual(api, c.BlockHash)
+
+	comparator := cmp.NewBoundedComparator(api, big.NewInt(int64(maxDepth+1)), false)
+	comparator.AssertIsLessEq(c.Depth, maxDepth)
+
+	//bit i of the index tells whether the node at level i is a right child
+	indexBits := api.ToBinary(c.Index, maxDepth)
+
+	node := c.TxId
+	for i := 0; i < maxDepth; i++ {
+		isActive := comparator.IsLess(i, c.Depth)
+		//the index can not point beyond the leaves of the tree
+		api.AssertIsEqual(api.Mul(api.Sub(1, isActive), indexBits[i]), 0)
+
+		pair := make([]uints.U8, 2*HashLen)
+		for j := 0; j < HashLen; j++ {
+			pair[j] = uints.U8{Val: api.Select(indexBits[i], c.Branch[i][j].Val, node[j].Val)}
+			pair[HashLen+j] = uints.U8{Val: api.Select(indexBits[i], node[j].Val, c.Branch[i][j].Val)}
+		}
+
+		parent, err := DoubleSha256(api, pair)
+		if err != nil {
+			return err
+		}
+
+		for j := 0; j < HashLen; j++ {
+			node[j] = uints.U8{Val: api.Select(isActive, parent[j].Val, node[j].Val)}
+		}
+	}
+
+	Hash(c.BlockHeader[MerkleRootOffset:MerkleRootOffset+HashLen]).AssertIsEqual(api, node)
+	return nil
+}
+
+func NewTxInclusionCircuit(maxDepth int) frontend.Circuit {
+	return &TxInclusionCircuit{
+		Branch: make([]Hash, maxDepth),
+	}
+}
+
+func NewTxInclusionAssignment(
+	maxDepth int,
+	blockHeader [BlockHeaderLen]byte,
+	txId [HashLen]byte,
+	branch [][HashLen]byte,
+	index uint32,
+) (frontend.Circuit, error) {
+	if len(branch) > maxDepth {
+		return nil, fmt.Errorf("branch depth %v exceeds %v", len(branch), maxDepth)
+	}
+
+	root := MerkleRootFromBranch(txId, branch, index)
+	if root != [HashLen]byte(blockHeader[MerkleRootOffset:MerkleRootOffset+HashLen]) {
+		return nil, fmt.Errorf("branch does not lead to the merkle root of the header")
+	}
+
+	blockHash := chainhash.DoubleHashH(blockHeader[:])
+
+	_blockHash := Hash{}
+	_txId := Hash{}
+	for i := 0; i < HashLen; i++ {
+		_blockHash[i] = uints.NewU8(blockHash[i])
+		_txId[i] = uints.NewU8(txId[i])
+	}
+
+	_blockHeader := [BlockHeaderLen]uints.U8{}
+	for i := 0; i < BlockHeaderLen; i++ {
+		_blockHeader[i] = uints.NewU8(blockHeader[i])
+	}
+
+	//unused levels are ignored by the circuit
+	_branch := make([]Hash, maxDepth)
+	for i := 0; i < maxDepth; i++ {
+		for j := 0; j < HashLen; j++ {
+			_branch[i][j] = uints.NewU8(0)
+			if i < len(branch) {
+				_branch[i][j] = uints.NewU8(branch[i][j])
+			}
+		}
+	}
+
+	return &TxInclusionCircuit{
+		BlockHash:   _blockHash,
+		TxId:        _txId,
+		Depth:       len(branch),
+		BlockHeader: _blockHeader,
+		Branch:      _branch,
+		Index:       index,
+	}, nil
+}
+
+// MerkleRoot computes the Merkle root of txIds the way Bitcoin does, duplicating the last node of
+// a level with an odd number of nodes.
+func MerkleRoot(txIds [][HashLen]byte) ([HashLen]byte, error) {
+	if len(txIds) == 0 {
+		return [HashLen]byte{}, fmt.Errorf("no transactions")
+	}
+
+	level := txIds
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+	return level[0], nil
+}
+
+// MerkleBranch returns the siblings from the leaf to the root of the transaction at index.
+func MerkleBranch(txIds [][HashLen]byte, index uint32) ([][HashLen]byte, error) {
+	if int(index) >= len(txIds) {
+		return nil, fmt.Errorf("index %v out of %v transactions", index, len(txIds))
+	}
+
+	var branch [][HashLen]byte
+	level := txIds
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if int(sibling) >= len(level) {
+			sibling = index
+		}
+		branch = append(branch, level[sibling])
+
+		level = merkleParents(level)
+		index >>= 1
+	}
+	return branch, nil
+}
+
+// MerkleRootFromBranch is the native counterpart of TxInclusionCircuit.
+func MerkleRootFromBranch(txId [HashLen]byte, branch [][HashLen]byte, index uint32) [HashLen]byte {
+	node := txId
+	for _, sibling := range branch {
+		if index&1 == 1 {
+			node = merkleParent(sibling, node)
+		} else {
+			node = merkleParent(node, sibling)
+		}
+		index >>= 1
+	}
+	return node
+}
+
+func merkleParents(level [][HashLen]byte) [][HashLen]byte {
+	parents := make([][HashLen]byte, (len(level)+1)/2)
+	for i := range parents {
+		right := level[len(level)-1]
+		if 2*i+1 < len(level) {
+			right = level[2*i+1]
+		}
+		parents[i] = merkleParent(level[2*i], right)
+	}
+	return parents
+}
+
+func merkleParent(left, right [HashLen]byte) [HashLen]byte {
+	return chainhash.DoubleHashH(append(left[:], right[:]...))
+}
@@ -0,0 +1,88 @@
+package circuits
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/test"
+	"testing"
+)
+
+func TestMerkleBranch(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for n := 1; n <= 9; n++ {
+		txIds := make([][HashLen]byte, n)
+		for i := range txIds {
+			txIds[i] = sha256.Sum256([]byte{byte(i)})
+		}
+		root, err := MerkleRoot(txIds)
+		assert.NoError(err)
+
+		for i := range txIds {
+			branch, err := MerkleBranch(txIds, uint32(i))
+			assert.NoError(err)
+			assert.Equal(root, MerkleRootFromBranch(txIds[i], branch, uint32(i)))
+		}
+	}
+}
+
+func TestTxInclusionCircuit_Simulation(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	//the block of headers[0] only holds its coinbase, whose txid is the merkle root
+	header, err := hex.DecodeString(headers[0])
+	assert.NoError(err)
+	coinbase := [HashLen]byte(header[MerkleRootOffset : MerkleRootOffset+HashLen])
+
+	assignment, err := NewTxInclusionAssignment(3, [BlockHeaderLen]byte(header), coinbase, nil, 0)
+	assert.NoError(err)
+	err = test.IsSolved(NewTxInclusionCircuit(3), assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	//a block of 5 transactions, committed to by a header with a made up merkle root
+	txIds := make([][HashLen]byte, 5)
+	for i := range txIds {
+		txIds[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	root, err := MerkleRoot(txIds)
+	assert.NoError(err)
+	copy(header[MerkleRootOffset:], root[:])
+
+	for _, index := range []uint32{0, 3, 4} {
+		branch, err := MerkleBranch(txIds, index)
+		assert.NoError(err)
+		assignment, err := NewTxInclusionAssignment(4, [BlockHeaderLen]byte(header), txIds[index], branch, index)
+		assert.NoError(err)
+		err = test.IsSolved(NewTxInclusionCircuit(4), assignment, ecc.BN254.ScalarField())
+		assert.NoError(err)
+	}
+
+	branch, err := MerkleBranch(txIds, 2)
+	assert.NoError(err)
+	_, err = NewTxInclusionAssignment(4, [BlockHeaderLen]byte(header), txIds[1], branch, 2)
+	assert.Error(err)
+
+	//the index must match the position of the transaction
+	assignment, err = NewTxInclusionAssignment(4, [BlockHeaderLen]byte(header), txIds[2], branch, 2)
+	assert.NoError(err)
+	bad := *(assignment.(*TxInclusionCircuit))
+	bad.Index = 3
+	err = test.IsSolved(NewTxInclusionCircuit(4), &bad, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//and lie within the tree
+	bad.Index = 2 + 1<<3
+	err = test.IsSolved(NewTxInclusionCircuit(4), &bad, ecc.BN254.ScalarField())
+	assert.Error(err)
+
+	//and the block hash must be the one of the header
+	bad = *(assignment.(*TxInclusionCircuit))
+	otherHash := chainhash.DoubleHashH([]byte{})
+	for i := 0; i < HashLen; i++ {
+		bad.BlockHash[i].Val = otherHash[i]
+	}
+	err = test.IsSolved(NewTxInclusionCircuit(4), &bad, ecc.BN254.ScalarField())
+	assert.Error(err)
+}
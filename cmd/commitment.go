@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"path/filepath"
+)
+
+func (a *artifacts) commitmentName(h circuits.CommitmentHash) string {
+	return a.recursiveName() + "_commitment_" + h.String()
+}
+
+func commitmentHashFlag(fs *flag.FlagSet) *string {
+	return fs.String("hash", circuits.Keccak256Commitment.String(), "hash of the commitment, sha256 or keccak256")
+}
+
+func setupCommitment(args []string) error {
+	fs := flag.NewFlagSet("setup-commitment", flag.ExitOnError)
+	srsDir := fs.String("srs", "", "directory of the srs files, an unsafe srs is generated if empty")
+	hashName := commitmentHashFlag(fs)
+	var a artifacts
+	a.register(fs)
+	_ = fs.Parse(args)
+
+	h, err := circuits.ParseCommitmentHash(*hashName)
+	if err != nil {
+		return err
+	}
+
+	recursiveCcs, err := operations.ReadCcs(a.file(a.recursiveName(), "ccs"))
+	if err != nil {
+		return err
+	}
+
+	recursiveVk, err := operations.ReadVk(a.file(a.recursiveName(), "vk"))
+	if err != nil {
+		return err
+	}
+
+	recursiveVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveVk)
+	if err != nil {
+		return err
+	}
+
+	circuit := circuits.NewBlockHeaderCommitmentCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		recursiveCcs,
+		recursiveVkFpBytes,
+		h,
+	)
+
+	ccs, err := operations.NewConstraintSystem(circuit)
+	if err != nil {
+		return err
+	}
+	return setup(ccs, a.commitmentName(h), &a, *srsDir)
+}
+
+func proveCommitment(args []string) error {
+	fs := flag.NewFlagSet("prove-commitment", flag.ExitOnError)
+	hashName := commitmentHashFlag(fs)
+	var a artifacts
+	a.register(fs)
+	recursive := fs.String("recursive", "", "path, without extension, of the recursive proof to commit to, e.g. proofs/block_header_recursive_0_3")
+	outDir := fs.String("out", "proofs", "directory the commitment proof is written to")
+	solidity := fs.Bool("solidity", false, "make the proof for the Solidity verifier of the commitment circuit")
+	_ = fs.Parse(args)
+
+	h, err := circuits.ParseCommitmentHash(*hashName)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.circuit(a.commitmentName(h))
+	if err != nil {
+		return err
+	}
+	recursiveVk, err := operations.ReadVk(a.file(a.recursiveName(), "vk"))
+	if err != nil {
+		return err
+	}
+	rp, err := prover.ReadRangeProof(recursiveVk, *recursive)
+	if err != nil {
+		return err
+	}
+
+	proof, wit, err := prover.Commit(c, h, rp, *solidity)
+	if err != nil {
+		return err
+	}
+
+	name := a.commitmentName(h)
+	if *solidity {
+		name += "_solidity"
+	}
+	base := proofBase(*outDir, name, rp.Public.BeginHeight, rp.Public.EndHeight())
+	err = operations.WriteProof(proof, base+".proof")
+	if err != nil {
+		return err
+	}
+	err = operations.WriteWitness(wit, base+".wtns")
+	if err != nil {
+		return err
+	}
+
+	commitment, err := circuits.CommitmentOf(wit)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v.proof for headers %v to %v, commitment 0x%064x\n", base, rp.Public.BeginHeight+1, rp.Public.EndHeight(), commitment)
+	return nil
+}
+
+func commitment(args []string) error {
+	fs := flag.NewFlagSet("commitment", flag.ExitOnError)
+	hashName := commitmentHashFlag(fs)
+	witnessFile := fs.String("witness", "", "public witness file of a recursive proof")
+	_ = fs.Parse(args)
+
+	h, err := circuits.ParseCommitmentHash(*hashName)
+	if err != nil {
+		return err
+	}
+
+	wit, err := operations.ReadWitness(*witnessFile)
+	if err != nil {
+		return err
+	}
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return err
+	}
+
+	c, err := circuits.Commitment(h, public)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v commitment of %v: 0x%064x\n", h, filepath.Base(*witnessFile), c)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/evm"
+	"os"
+)
+
+func exportSolidity(args []string) error {
+	fs := flag.NewFlagSet("export-solidity", flag.ExitOnError)
+	vkFile := fs.String("vk", "artifacts/block_header_recursive.vk", "verifying key file")
+	out := fs.String("out", "BlockHeaderVerifier.sol", "Solidity file the verifier contract is written to")
+	_ = fs.Parse(args)
+
+	vk, err := operations.ReadVk(*vkFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = evm.ExportVerifier(vk, f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v, verify with %v\n", *out, evm.VerifySignature)
+	return f.Close()
+}
+
+func calldata(args []string) error {
+	fs := flag.NewFlagSet("calldata", flag.ExitOnError)
+	vkFile := fs.String("vk", "", "verifying key file")
+	proofFile := fs.String("proof", "", "proof file, proven with prove-range -solidity")
+	witnessFile := fs.String("witness", "", "public witness file")
+	out := fs.String("out", "", "file the hex encoded calldata is written to, stdout if empty")
+	_ = fs.Parse(args)
+
+	vk, err := operations.ReadVk(*vkFile)
+	if err != nil {
+		return err
+	}
+	proof, err := operations.ReadProof(*proofFile)
+	if err != nil {
+		return err
+	}
+	wit, err := operations.ReadWitness(*witnessFile)
+	if err != nil {
+		return err
+	}
+
+	c, err := evm.NewCalldata(proof, wit)
+	if err != nil {
+		return err
+	}
+	data := c.Encode()
+
+	//what the contract will be given must verify
+	decoded, err := evm.DecodeCalldata(data)
+	if err != nil {
+		return err
+	}
+	err = decoded.Verify(vk, proof)
+	if err != nil {
+		return fmt.Errorf("calldata does not verify, the proof must come from prove-range -solidity: %v", err)
+	}
+
+	encoded := "0x" + hex.EncodeToString(data)
+	if *out == "" {
+		fmt.Println(encoded)
+		return nil
+	}
+	return os.WriteFile(*out, []byte(encoded+"\n"), 0644)
+}
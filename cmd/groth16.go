@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"github.com/readygo67/BlockHeaderProver/utils"
+)
+
+func (a *artifacts) groth16Name() string {
+	return a.recursiveName() + "_groth16"
+}
+
+// groth16Circuit loads the artifacts of the Groth16 circuit.
+func (a *artifacts) groth16Circuit() (*prover.Groth16Circuit, error) {
+	name := a.groth16Name()
+	return prover.ReadGroth16Circuit(a.file(name, "ccs"), a.file(name, "pk"), a.file(name, "vk"))
+}
+
+func setupGroth16(args []string) error {
+	fs := flag.NewFlagSet("setup-groth16", flag.ExitOnError)
+	var a artifacts
+	a.register(fs)
+	_ = fs.Parse(args)
+
+	recursiveCcs, err := operations.ReadCcs(a.file(a.recursiveName(), "ccs"))
+	if err != nil {
+		return err
+	}
+
+	recursiveVk, err := operations.ReadVk(a.file(a.recursiveName(), "vk"))
+	if err != nil {
+		return err
+	}
+
+	recursiveVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveVk)
+	if err != nil {
+		return err
+	}
+
+	c, err := prover.SetupGroth16(recursiveCcs, recursiveVkFpBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("nbConstraints:%v, nbPublicWitness:%v, nbSecretWitness:%v, nbInternalVariables:%v\n", c.Ccs.GetNbConstraints(), c.Ccs.GetNbPublicVariables(), c.Ccs.GetNbSecretVariables(), c.Ccs.GetNbInternalVariables())
+
+	name := a.groth16Name()
+	err = prover.WriteGroth16Circuit(c, a.file(name, "ccs"), a.file(name, "pk"), a.file(name, "vk"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("successfully setup %v circuit\n", name)
+	return nil
+}
+
+func proveGroth16(args []string) error {
+	fs := flag.NewFlagSet("prove-groth16", flag.ExitOnError)
+	var a artifacts
+	a.register(fs)
+	recursive := fs.String("recursive", "", "path, without extension, of the recursive proof to wrap, e.g. proofs/block_header_recursive_0_3")
+	outDir := fs.String("out", "proofs", "directory the Groth16 proof is written to")
+	_ = fs.Parse(args)
+
+	c, err := a.groth16Circuit()
+	if err != nil {
+		return err
+	}
+	recursiveVk, err := operations.ReadVk(a.file(a.recursiveName(), "vk"))
+	if err != nil {
+		return err
+	}
+	rp, err := prover.ReadRangeProof(recursiveVk, *recursive)
+	if err != nil {
+		return err
+	}
+
+	proof, wit, err := c.Wrap(rp)
+	if err != nil {
+		return err
+	}
+
+	base := proofBase(*outDir, a.groth16Name(), rp.Public.BeginHeight, rp.Public.EndHeight())
+	err = prover.WriteGroth16Proof(proof, base+".proof")
+	if err != nil {
+		return err
+	}
+	err = operations.WriteWitness(wit, base+".wtns")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v.proof for headers %v to %v\n", base, rp.Public.BeginHeight+1, rp.Public.EndHeight())
+	return nil
+}
+
+func verifyGroth16(args []string) error {
+	fs := flag.NewFlagSet("verify-groth16", flag.ExitOnError)
+	vkFile := fs.String("vk", "", "Groth16 verifying key file")
+	proofFile := fs.String("proof", "", "Groth16 proof file")
+	witnessFile := fs.String("witness", "", "public witness file")
+	_ = fs.Parse(args)
+
+	vk, err := prover.ReadGroth16Vk(*vkFile)
+	if err != nil {
+		return err
+	}
+	proof, err := prover.ReadGroth16Proof(*proofFile)
+	if err != nil {
+		return err
+	}
+	wit, err := operations.ReadWitness(*witnessFile)
+	if err != nil {
+		return err
+	}
+
+	err = groth16.Verify(proof, vk, wit)
+	if err != nil {
+		return err
+	}
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("proof is valid for headers %v to %v, %v to %v, recursive vk fingerprint %x\n",
+		public.BeginHeight+1, public.EndHeight(), chainhash.Hash(public.BeginHash), chainhash.Hash(public.EndHash), []byte(public.VkFp))
+	return nil
+}
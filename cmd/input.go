@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/headers"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"os"
+	"strings"
+	"time"
+)
+
+// headerInput holds the flags describing where the headers to prove come from.
+type headerInput struct {
+	network     *string
+	headersFile string
+	blocksDir   string
+	rpc         headers.RPCConfig
+	p2p         headers.P2PConfig
+	esplora     headers.EsploraConfig
+	count       uint
+}
+
+func (in *headerInput) register(fs *flag.FlagSet) {
+	in.network = networkFlag(fs)
+	fs.StringVar(&in.headersFile, "headers", "", "file of hex encoded headers, one per line, '#' starts a comment")
+	fs.StringVar(&in.blocksDir, "blocks-dir", "", "read the headers from the blk*.dat files of a stopped Bitcoin Core node instead of -headers")
+	fs.StringVar(&in.rpc.URL, "rpc-url", "", "fetch the headers from the JSON-RPC interface of bitcoind at this url instead of -headers")
+	fs.StringVar(&in.rpc.User, "rpc-user", "", "bitcoind rpc user")
+	fs.StringVar(&in.rpc.Password, "rpc-password", "", "bitcoind rpc password")
+	fs.StringVar(&in.rpc.CookieFile, "rpc-cookie", "", "bitcoind .cookie file, instead of -rpc-user and -rpc-password")
+	fs.IntVar(&in.rpc.Retries, "rpc-retries", 3, "retries of a failed rpc request")
+	fs.DurationVar(&in.rpc.RetryDelay, "rpc-retry-delay", time.Second, "delay before the first retry of a failed rpc request")
+	fs.StringVar(&in.p2p.Address, "peer", "", "sync the headers from a node over the p2p protocol at this host[:port] instead of -headers")
+	fs.StringVar(&in.esplora.URL, "esplora-url", "", "fetch the headers from the REST API of Esplora at this base url instead of -headers")
+	fs.IntVar(&in.esplora.Concurrency, "esplora-concurrency", headers.DefaultEsploraConcurrency, "esplora requests in flight at once")
+	fs.UintVar(&in.count, "count", 0, "number of headers to take from the headers file or the header source, 0 for all of the file or all up to the tip of the source")
+}
+
+// chainInput holds the flags describing a range of headers to prove and the chain state it builds on.
+type chainInput struct {
+	headerInput
+	stateFile   string
+	beginHeight uint
+}
+
+func (in *chainInput) register(fs *flag.FlagSet) {
+	in.headerInput.register(fs)
+	fs.StringVar(&in.stateFile, "state", "", "json file of the chain state after the block the first header builds on, defaults to the genesis state if -begin-height is 0")
+	fs.UintVar(&in.beginHeight, "begin-height", 0, "height of the block the first header builds on")
+}
+
+func (in *chainInput) load() (*prover.Chain, error) {
+	net, err := circuits.NetworkByName(*in.network)
+	if err != nil {
+		return nil, err
+	}
+	blockHeaders, err := in.readHeaders(net, uint32(in.beginHeight))
+	if err != nil {
+		return nil, err
+	}
+
+	var beginState circuits.NativeChainState
+	switch {
+	case in.stateFile != "":
+		beginState, err = readState(in.stateFile)
+		if err != nil {
+			return nil, err
+		}
+	case in.beginHeight == 0:
+		beginState = net.GenesisState()
+		if chainhash.Hash(blockHeaders[0][circuits.BeginHashOffset:circuits.BeginHashOffset+circuits.HashLen]) != net.GenesisHash {
+			return nil, fmt.Errorf("first header does not build on the %v genesis block", net.Name)
+		}
+	default:
+		return nil, fmt.Errorf("no state file given for begin height %v", in.beginHeight)
+	}
+
+	return prover.NewChain(net, blockHeaders, uint32(in.beginHeight), beginState)
+}
+
+// readHeaders reads the headers from the headers file or from the header source given by the flags,
+// a source is asked for the headers above beginHeight.
+func (in *headerInput) readHeaders(net *circuits.Network, beginHeight uint32) ([][circuits.BlockHeaderLen]byte, error) {
+	if in.headersFile != "" {
+		blockHeaders, err := readHeaders(in.headersFile)
+		if err != nil {
+			return nil, err
+		}
+		if in.count == 0 {
+			return blockHeaders, nil
+		}
+		if uint(len(blockHeaders)) < in.count {
+			return nil, fmt.Errorf("%v holds %v headers, fewer than -count %v", in.headersFile, len(blockHeaders), in.count)
+		}
+		return blockHeaders[:in.count], nil
+	}
+
+	source, err := in.source(net)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	count := int(in.count)
+	if count == 0 {
+		tip, err := source.TipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if tip <= beginHeight {
+			return nil, fmt.Errorf("no headers above height %v, tip is at %v", beginHeight, tip)
+		}
+		count = int(tip - beginHeight)
+	}
+	return source.Headers(ctx, beginHeight+1, count)
+}
+
+func (in *headerInput) source(net *circuits.Network) (headers.Source, error) {
+	switch {
+	case in.blocksDir != "":
+		return headers.NewBlkFileSource(net, in.blocksDir)
+	case in.rpc.URL != "":
+		return headers.NewRPCSource(in.rpc)
+	case in.p2p.Address != "":
+		return headers.NewP2PSource(net, in.p2p)
+	case in.esplora.URL != "":
+		return headers.NewEsploraSource(in.esplora)
+	default:
+		return nil, fmt.Errorf("no headers file or header source given")
+	}
+}
+
+func readHeaders(fn string) ([][circuits.BlockHeaderLen]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var headers [][circuits.BlockHeaderLen]byte
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		header, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fn, line, err)
+		}
+		if len(header) != circuits.BlockHeaderLen {
+			return nil, fmt.Errorf("%v:%v: header of %v bytes", fn, line, len(header))
+		}
+		headers = append(headers, [circuits.BlockHeaderLen]byte(header))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("%v: no headers", fn)
+	}
+	return headers, nil
+}
+
+func readState(fn string) (circuits.NativeChainState, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return circuits.NativeChainState{}, err
+	}
+
+	var state circuits.NativeChainState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return circuits.NativeChainState{}, fmt.Errorf("%v: %v", fn, err)
+	}
+	return state, nil
+}
@@ -1,303 +1,180 @@
 package main
 
 import (
-	"encoding/hex"
+	"flag"
 	"fmt"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	native_plonk "github.com/consensys/gnark/backend/plonk"
-	"github.com/consensys/gnark/backend/witness"
-	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/test/unsafekzg"
 	"github.com/lightec-xyz/common/operations"
 	"github.com/readygo67/BlockHeaderProver/circuits"
-	"github.com/readygo67/BlockHeaderProver/utils"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"os"
+	"path/filepath"
+	"strconv"
 )
 
-var (
-	_headers = []string{
-		"01000000b5fbf970bf362cc3203d71022d0764ce966a9d5cee7615354e273624000000008c209cca50575be7aad6faf11c26af9d91fc91f9bf953c1e7d4fca44e44be3fa3d286f49ffff001d2e18e5ed",
-		"010000003c668f799ca5472fd05b8d43c574469fbec46ae3ffec010cdf6ee31100000000a97c6e691b813753248aa4614e4d3a34a3d1471e6ad863a392ccf4687d857a30f92b6f49ffff001d22239e3b",
-		"010000001588b0752fb18960bf8b1728964d091b638e35e3a2c9ed32991da8c300000000cf18302909e57a7687e38d109ff19d01e85fd0f5517ffe821055765193ca51da162f6f49ffff001d16a2ddc4",
-	}
-
-	unitCcsFile      = "../testdata/block_header_unit.ccs"
-	unitPkFile       = "../testdata/block_header_unit.pk"
-	unitVkFile       = "../testdata/block_header_unit.vk"
-	recursiveCcsFile = "../testdata/block_header_recursive.ccs"
-	recursivePkFile  = "../testdata/block_header_recursive.pk"
-	recursiveVkFile  = "../testdata/block_header_recursive.vk"
-	toxicValue       = []byte{05, 06, 07} //seed for srs
-)
-
-func main() {
-	err := setupUnit()
-	if err != nil {
-		panic(err)
-	}
-
-	err = setupRecursive()
-	if err != nil {
-		panic(err)
-	}
-
-	unitProofs, unitWitness, err := buildUnitProofs()
-	if err != nil {
-		panic(err)
-	}
-
-	_, _, err = buildRecursiveProof(unitProofs, unitWitness)
-	if err != nil {
-		panic(err)
-	}
+var toxicValue = []byte{05, 06, 07} //seed for the unsafe srs used when no srs directory is given
 
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
 }
 
-func setupUnit() error {
-	circuit := circuits.NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl]()
-	ccs, err := operations.NewConstraintSystem(circuit)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("nbConstraints:%v, nbPublicWitness:%v, nbSecretWitness:%v, nbInternalVariables:%v\n", ccs.GetNbConstraints(), ccs.GetNbPublicVariables(), ccs.GetNbSecretVariables(), ccs.GetNbInternalVariables())
-
-	srs, lsrs, err := unsafekzg.NewSRS(ccs, unsafekzg.WithToxicSeed(toxicValue))
-	if err != nil {
-		return err
-	}
-
-	pk, vk, err := operations.PlonkSetup(ccs, &srs, &lsrs)
-	if err != nil {
-		return err
-	}
+var commands = []command{
+	{"setup-unit", "compile and set up the unit (or batch) circuit", setupUnit},
+	{"setup-recursive", "compile and set up the recursive circuit over the unit artifacts", setupRecursive},
+	{"prove-unit", "prove every header (or batch of headers) of a headers file", proveUnit},
+	{"prove-range", "merge the unit proofs of a headers file into one recursive proof", proveRange},
+	{"prove", "prove a headers file end to end, merging unit proofs as they are done", prove},
+	{"extend", "prove new headers and fold them into an existing proof", extend},
+	{"list", "list the proofs of a proof store", list},
+	{"verify", "verify a proof against its verifying key and public witness", verify},
+	{"pack", "bundle a proof and its witness into an envelope with what they prove", pack},
+	{"inspect", "print the public witness of a proof", inspect},
+	{"export-solidity", "export a verifying key as a Solidity verifier contract", exportSolidity},
+	{"calldata", "encode a proof and its public inputs as calldata of the Solidity verifier", calldata},
+	{"setup-commitment", "compile and set up the circuit committing to the public inputs of a recursive proof", setupCommitment},
+	{"prove-commitment", "wrap a recursive proof into a proof of the commitment to its public inputs", proveCommitment},
+	{"commitment", "compute the commitment to the public inputs of a recursive proof", commitment},
+	{"setup-groth16", "compile and set up the Groth16 circuit wrapping recursive proofs", setupGroth16},
+	{"prove-groth16", "wrap a recursive proof into a Groth16 proof", proveGroth16},
+	{"verify-groth16", "verify a Groth16 proof against its verifying key and public witness", verifyGroth16},
+}
 
-	err = operations.WriteCcs(ccs, unitCcsFile)
-	if err != nil {
-		return err
-	}
-	err = operations.WritePk(pk, unitPkFile)
-	if err != nil {
-		return err
-	}
-	err = operations.WriteVk(vk, unitVkFile)
-	if err != nil {
-		return err
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
 
-	_, err = utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
-	if err != nil {
-		return err
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		err := cmd.run(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	fmt.Printf("successfully setup block_header_unit circuit\n")
-	return nil
+	fmt.Fprintf(os.Stderr, "unknown command %v\n", os.Args[1])
+	usage()
+	os.Exit(2)
 }
 
-func setupRecursive() error {
-	unitCcs, err := operations.ReadCcs(unitCcsFile)
-	if err != nil {
-		return err
-	}
-
-	unitVk, err := operations.ReadVk(unitVkFile)
-	if err != nil {
-		return err
-	}
-
-	unitVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](unitVk)
-	if err != nil {
-		return err
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %v <command> [flags]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16v %v\n", cmd.name, cmd.usage)
 	}
+	fmt.Fprintf(os.Stderr, "\nrun %v <command> -h for the flags of a command\n", filepath.Base(os.Args[0]))
+}
 
-	circuit := circuits.NewBlockHeaderRecursiveCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
-		unitCcs,
-		unitVkFpBytes,
-	)
+// artifacts locates the ccs, pk and vk files of the circuits in a directory. The circuits depend on
+// the network, every network needs its own directory.
+type artifacts struct {
+	dir   string
+	batch int //number of headers per leaf proof, 0 for the unit circuit
+}
 
-	ccs, err := operations.NewConstraintSystem(circuit)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("nbConstraints:%v, nbPublicWitness:%v, nbSecretWitness:%v, nbInternalVariables:%v\n", ccs.GetNbConstraints(), ccs.GetNbPublicVariables(), ccs.GetNbSecretVariables(), ccs.GetNbInternalVariables())
+func (a *artifacts) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.dir, "artifacts", "artifacts", "directory of the circuit artifacts (ccs, pk, vk)")
+	fs.Func("batch", "prove leaves of this many headers, a power of two, with the batch circuit instead of the unit circuit", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		a.batch = n
+		return prover.CheckBatchSize(n)
+	})
+}
 
-	srs, lsrs, err := unsafekzg.NewSRS(ccs, unsafekzg.WithToxicSeed(toxicValue))
-	if err != nil {
-		return err
+// leafSize returns the number of headers proven by a leaf proof.
+func (a *artifacts) leafSize() int {
+	if a.batch == 0 {
+		return 1
 	}
+	return a.batch
+}
 
-	pk, vk, err := operations.PlonkSetup(ccs, &srs, &lsrs)
-	if err != nil {
-		return err
+func (a *artifacts) leafName() string {
+	if a.batch == 0 {
+		return "block_header_unit"
 	}
+	return fmt.Sprintf("block_header_batch_%v", a.batch)
+}
 
-	err = operations.WriteCcs(ccs, recursiveCcsFile)
-	if err != nil {
-		return err
-	}
-	err = operations.WritePk(pk, recursivePkFile)
-	if err != nil {
-		return err
+func (a *artifacts) recursiveName() string {
+	if a.batch == 0 {
+		return "block_header_recursive"
 	}
-	err = operations.WriteVk(vk, recursiveVkFile)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("successfully setup block_header_recursive circuit\n")
-	return nil
+	return fmt.Sprintf("block_header_recursive_batch_%v", a.batch)
 }
 
-func buildUnitProofs() ([]native_plonk.Proof, []witness.Witness, error) {
-	headers := make([][]byte, len(_headers))
-	hashes := make([][32]byte, len(_headers))
-
-	proofs := make([]native_plonk.Proof, len(_headers))
-	witness := make([]witness.Witness, len(_headers))
-
-	for i, h := range _headers {
-		headers[i], _ = hex.DecodeString(h)
-		hashes[i] = chainhash.DoubleHashH(headers[i])
-	}
+func (a *artifacts) file(name, ext string) string {
+	return filepath.Join(a.dir, name+"."+ext)
+}
 
-	ccs, err := operations.ReadCcs(unitCcsFile)
+// circuit loads the artifacts of the circuit named name.
+func (a *artifacts) circuit(name string) (*prover.Circuit, error) {
+	ccs, err := operations.ReadCcs(a.file(name, "ccs"))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	pk, err := operations.ReadPk(unitPkFile)
+	pk, err := operations.ReadPk(a.file(name, "pk"))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	vk, err := operations.ReadVk(unitVkFile)
+	vk, err := operations.ReadVk(a.file(name, "vk"))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	return prover.NewCircuit(ccs, pk, vk)
+}
 
-	vkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+// prover loads the leaf circuit, and the recursive circuit if withRecursive is set.
+func (a *artifacts) prover(net *circuits.Network, withRecursive bool) (*prover.Prover, error) {
+	leaf, err := a.circuit(a.leafName())
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	for i := 0; i < len(headers); i++ {
-		assignment := circuits.NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](hashes[i], [80]byte(headers[i]), vkFpBytes)
-		proof, wit, err := operations.PlonkProve(ccs, pk, assignment, false)
+	p := &prover.Prover{Network: net, Leaf: leaf, BatchSize: a.batch}
+	if withRecursive {
+		p.Recursive, err = a.circuit(a.recursiveName())
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-
-		err = operations.PlonkVerify(vk, proof, wit, false)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		proofFile := fmt.Sprintf("../testdata/block_header_unit_%v_%v.proof", i, i+1)
-		witnessFile := fmt.Sprintf("../testdata/block_header_unit_%v_%v.wtns", i, i+1)
-
-		err = operations.WriteProof(proof, proofFile)
-		if err != nil {
-			panic(err)
-		}
-		err = operations.WriteWitness(wit, witnessFile)
-		if err != nil {
-			panic(err)
-		}
-
-		proofs[i] = proof
-		witness[i] = wit
-
 	}
-	return proofs, witness, nil
+	return p, nil
 }
 
-func buildRecursiveProof(unitProofs []native_plonk.Proof, unitWitnesses []witness.Witness) (native_plonk.Proof, witness.Witness, error) {
-	//Build the first recursive proof
-	headers := make([][]byte, len(_headers))
-	hashes := make([][32]byte, len(_headers))
-
-	recursiveProofs := []native_plonk.Proof{}
-	recursiveWitnesses := []witness.Witness{}
-
-	for i, h := range _headers {
-		headers[i], _ = hex.DecodeString(h)
-		hashes[i] = chainhash.DoubleHashH(headers[i])
-	}
-	beginHash := [32]byte(headers[0][4:36])
-
-	unitVk, err := operations.ReadVk(unitVkFile)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	recursiveVk, err := operations.ReadVk(recursiveVkFile)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	recursiveVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveVk)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	recursiveVkFp := utils.FingerPrintFromBytes[sw_bn254.ScalarField](recursiveVkFpBytes)
-
-	assignment, err := circuits.NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
-		unitVk, unitVk,
-		unitProofs[0], unitProofs[1],
-		unitWitnesses[0], unitWitnesses[1],
-		recursiveVkFp,
-		beginHash,
-		hashes[0],
-		hashes[1],
-	)
-
-	recursiveCcs, err := operations.ReadCcs(recursiveCcsFile)
-	if err != nil {
-		return nil, nil, err
-	}
+// proofBase returns the path, without extension, of the files of the proof named name over the
+// headers above beginHeight up to endHeight.
+func proofBase(dir, name string, beginHeight, endHeight uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%v_%v_%v", name, beginHeight, endHeight))
+}
 
-	recursivePk, err := operations.ReadPk(recursivePkFile)
-	if err != nil {
-		return nil, nil, err
-	}
+func networkFlag(fs *flag.FlagSet) *string {
+	return fs.String("network", circuits.MainNet.Name, "network of the headers, one of mainnet, testnet3, testnet4, signet, regtest")
+}
 
-	proof, witness, err := operations.PlonkProve(recursiveCcs, recursivePk, assignment, false)
-	if err != nil {
-		return nil, nil, err
+// newSRS reads the srs for ccs from srsDir, or derives an unsafe one from toxicValue if srsDir is
+// empty. The unsafe srs is only fit for testing.
+func newSRS(ccs constraint.ConstraintSystem, srsDir string) (*kzg.SRS, *kzg.SRS, error) {
+	if srsDir != "" {
+		return operations.ReadSrs(ccs.GetNbConstraints()+ccs.GetNbPublicVariables(), srsDir)
 	}
 
-	err = operations.PlonkVerify(recursiveVk, proof, witness, false)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs, unsafekzg.WithToxicSeed(toxicValue))
 	if err != nil {
 		return nil, nil, err
 	}
-
-	recursiveProofs = append(recursiveProofs, proof)
-	recursiveWitnesses = append(recursiveWitnesses, witness)
-
-	for i := 2; i < len(_headers); i++ {
-		assignment, err = circuits.NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
-			recursiveVk, unitVk,
-			recursiveProofs[i-2], unitProofs[i],
-			recursiveWitnesses[i-2], unitWitnesses[i],
-			recursiveVkFp,
-			beginHash,
-			hashes[i-1],
-			hashes[i],
-		)
-
-		proof, witness, err = operations.PlonkProve(recursiveCcs, recursivePk, assignment, false)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		err = operations.PlonkVerify(recursiveVk, proof, witness, false)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		recursiveProofs = append(recursiveProofs, proof)
-		recursiveWitnesses = append(recursiveWitnesses, witness)
-
-	}
-
-	return recursiveProofs[len(recursiveProofs)-1], recursiveWitnesses[len(recursiveWitnesses)-1], nil
-
+	return &srs, &lsrs, nil
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"github.com/readygo67/BlockHeaderProver/store"
+	"runtime"
+	"time"
+)
+
+func proveUnit(args []string) error {
+	fs := flag.NewFlagSet("prove-unit", flag.ExitOnError)
+	var in chainInput
+	in.register(fs)
+	var a artifacts
+	a.register(fs)
+	outDir := fs.String("out", "proofs", "directory the unit proofs are written to")
+	storeDir := fs.String("store", "", "proof store to keep the unit proofs in, instead of -out")
+	var pool poolFlags
+	pool.register(fs)
+	_ = fs.Parse(args)
+
+	c, err := in.load()
+	if err != nil {
+		return err
+	}
+
+	p, err := a.prover(c.Network, false)
+	if err != nil {
+		return err
+	}
+
+	cfg := pool.config()
+	if *storeDir != "" {
+		st, err := store.Open(*storeDir)
+		if err != nil {
+			return err
+		}
+		cfg.OnProof = storeLeaves(st, cfg.OnProof)
+		_, err = p.ProveLeavesParallel(context.Background(), c, cfg)
+		return err
+	}
+
+	cfg.OnProof = func(index int, rp *prover.RangeProof, took time.Duration) error {
+		base := proofBase(*outDir, a.leafName(), rp.Public.BeginHeight, rp.Public.EndHeight())
+		err := prover.WriteRangeProof(rp, base)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("wrote %v.proof, proved in %v\n", base, took.Round(time.Millisecond))
+		return nil
+	}
+	_, err = p.ProveLeavesParallel(context.Background(), c, cfg)
+	return err
+}
+
+func proveRange(args []string) error {
+	fs := flag.NewFlagSet("prove-range", flag.ExitOnError)
+	var in chainInput
+	in.register(fs)
+	var a artifacts
+	a.register(fs)
+	proofsDir := fs.String("proofs", "proofs", "directory of the unit proofs written by prove-unit")
+	outDir := fs.String("out", "proofs", "directory the recursive proof is written to")
+	treeMode := fs.Bool("tree", false, "merge the unit proofs as a binary tree instead of a linear chain")
+	solidity := fs.Bool("solidity", false, "make the last merge for the Solidity verifier, the proof cannot be extended")
+	_ = fs.Parse(args)
+
+	c, err := in.load()
+	if err != nil {
+		return err
+	}
+	leaves, err := c.Leaves(a.leafSize())
+	if err != nil {
+		return err
+	}
+	if len(leaves) < 2 {
+		return fmt.Errorf("a recursive proof needs at least two unit proofs")
+	}
+
+	p, err := a.prover(c.Network, true)
+	if err != nil {
+		return err
+	}
+
+	unitProofs := make([]*prover.RangeProof, len(leaves))
+	for i, leaf := range leaves {
+		base := proofBase(*proofsDir, a.leafName(), c.BeginHeight+uint32(leaf[0]), c.BeginHeight+uint32(leaf[1]))
+		unitProofs[i], err = prover.ReadRangeProof(p.Leaf.Vk, base)
+		if err != nil {
+			return err
+		}
+		if unitProofs[i].Public.EndHash != c.Hashes[leaf[1]-1] {
+			return fmt.Errorf("%v does not prove the given headers", base)
+		}
+	}
+
+	fold := p.Fold
+	if *treeMode {
+		fold = p.FoldTree
+	}
+	if !*solidity {
+		result, err := fold(unitProofs)
+		if err != nil {
+			return err
+		}
+		return writeProof(a.recursiveName(), *outDir, result)
+	}
+
+	last := len(unitProofs) - 1
+	acc, err := fold(unitProofs[:last])
+	if err != nil {
+		return err
+	}
+	result, err := p.MergeSolidity(acc, unitProofs[last])
+	if err != nil {
+		return err
+	}
+	return writeProof(a.recursiveName()+"_solidity", *outDir, result)
+}
+
+func prove(args []string) error {
+	fs := flag.NewFlagSet("prove", flag.ExitOnError)
+	var in chainInput
+	in.register(fs)
+	var a artifacts
+	a.register(fs)
+	outDir := fs.String("out", "proofs", "directory the recursive proof is written to")
+	storeDir := fs.String("store", "", "proof store to resume from the longest stored proof of the headers and to keep the proofs in, instead of -out")
+	var pool poolFlags
+	pool.register(fs)
+	_ = fs.Parse(args)
+
+	c, err := in.load()
+	if err != nil {
+		return err
+	}
+
+	p, err := a.prover(c.Network, true)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	cfg := pool.config()
+	if *storeDir == "" {
+		result, err := p.ProvePipelined(ctx, nil, c, cfg)
+		if err != nil {
+			return err
+		}
+		return writeProof(a.recursiveName(), *outDir, result)
+	}
+
+	st, err := store.Open(*storeDir)
+	if err != nil {
+		return err
+	}
+	prev, err := bestCovering(st, p, c)
+	if err != nil {
+		return err
+	}
+
+	var result *prover.RangeProof
+	switch {
+	case prev == nil:
+		cfg.OnProof = storeLeaves(st, cfg.OnProof)
+		result, err = p.ProvePipelined(ctx, nil, c, cfg)
+	case prev.Public.EndHeight() == c.Height(len(c.Headers)-1):
+		fmt.Printf("headers %v to %v are proven already\n", c.Height(0), prev.Public.EndHeight())
+		return nil
+	default:
+		fmt.Printf("resuming from the stored proof of headers %v to %v\n", prev.Public.BeginHeight+1, prev.Public.EndHeight())
+		cfg.OnProof = storeLeaves(st, cfg.OnProof)
+		result, err = p.Extend(ctx, prev, c.Headers[prev.Public.EndHeight()-c.BeginHeight:], cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = st.Put(result)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("stored the proof of headers %v to %v\n", result.Public.BeginHeight+1, result.Public.EndHeight())
+	return nil
+}
+
+// bestCovering reads the stored leaf or recursive proof covering the most leaves of c from its
+// beginning, or returns nil if there is none.
+func bestCovering(st *store.Store, p *prover.Prover, c *prover.Chain) (*prover.RangeProof, error) {
+	leaves, err := c.Leaves(p.LeafSize())
+	if err != nil {
+		return nil, err
+	}
+	ends := make([][circuits.HashLen]byte, len(leaves))
+	for i, leaf := range leaves {
+		ends[i] = c.Hashes[leaf[1]-1]
+	}
+
+	entry, ok, err := st.Best(c.ParentHash(), ends, p.Recursive.VkFp, p.Leaf.VkFp)
+	if err != nil || !ok {
+		return nil, err
+	}
+	vk := p.Recursive.Vk
+	if entry.VkFp == hex.EncodeToString(p.Leaf.VkFp) {
+		vk = p.Leaf.Vk
+	}
+	return st.Get(entry.Key, vk)
+}
+
+// storeLeaves wraps onProof to put every leaf proof into st as well.
+func storeLeaves(st *store.Store, onProof func(int, *prover.RangeProof, time.Duration) error) func(int, *prover.RangeProof, time.Duration) error {
+	return func(index int, rp *prover.RangeProof, took time.Duration) error {
+		_, err := st.Put(rp)
+		if err != nil {
+			return err
+		}
+		return onProof(index, rp, took)
+	}
+}
+
+func extend(args []string) error {
+	fs := flag.NewFlagSet("extend", flag.ExitOnError)
+	var in headerInput
+	in.register(fs)
+	var a artifacts
+	a.register(fs)
+	prev := fs.String("prev", "", "path, without extension, of the proof to extend, e.g. proofs/block_header_recursive_0_3")
+	outDir := fs.String("out", "proofs", "directory the extended proof is written to")
+	var pool poolFlags
+	pool.register(fs)
+	_ = fs.Parse(args)
+
+	net, err := circuits.NetworkByName(*in.network)
+	if err != nil {
+		return err
+	}
+	p, err := a.prover(net, true)
+	if err != nil {
+		return err
+	}
+
+	prevProof, err := prover.ReadRangeProof(p.Recursive.Vk, *prev)
+	if err != nil {
+		return err
+	}
+	//the proof being extended may still be a single leaf proof
+	if bytes.Equal(prevProof.Public.VkFp, p.Leaf.VkFp) {
+		prevProof.Vk = p.Leaf.Vk
+	}
+
+	blockHeaders, err := in.readHeaders(net, prevProof.Public.EndHeight())
+	if err != nil {
+		return err
+	}
+
+	result, err := p.Extend(context.Background(), prevProof, blockHeaders, pool.config())
+	if err != nil {
+		return err
+	}
+	return writeProof(a.recursiveName(), *outDir, result)
+}
+
+// writeProof writes rp to outDir as a proof of the circuit named name.
+func writeProof(name, outDir string, rp *prover.RangeProof) error {
+	base := proofBase(outDir, name, rp.Public.BeginHeight, rp.Public.EndHeight())
+	err := prover.WriteRangeProof(rp, base)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %v.proof for headers %v to %v\n", base, rp.Public.BeginHeight+1, rp.Public.EndHeight())
+	return nil
+}
+
+// poolFlags holds the flags bounding the proofs run at once.
+type poolFlags struct {
+	workers  int
+	memoryMB uint64
+}
+
+func (f *poolFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.workers, "workers", runtime.GOMAXPROCS(0), "proofs run at once")
+	fs.Uint64Var(&f.memoryMB, "memory-mb", 0, "memory in MiB the proofs run at once may take together, 0 for no limit")
+}
+
+// config returns the pool config, reporting the time every proof took.
+func (f *poolFlags) config() prover.PoolConfig {
+	return prover.PoolConfig{
+		Workers:      f.workers,
+		MemoryBudget: f.memoryMB << 20,
+		OnProof: func(index int, rp *prover.RangeProof, took time.Duration) error {
+			fmt.Printf("proved headers %v to %v in %v\n", rp.Public.BeginHeight+1, rp.Public.EndHeight(), took.Round(time.Millisecond))
+			return nil
+		},
+		OnMerge: func(rp *prover.RangeProof, took time.Duration) error {
+			fmt.Printf("merged headers %v to %v in %v\n", rp.Public.BeginHeight+1, rp.Public.EndHeight(), took.Round(time.Millisecond))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/utils"
+)
+
+func setupUnit(args []string) error {
+	fs := flag.NewFlagSet("setup-unit", flag.ExitOnError)
+	networkName := networkFlag(fs)
+	srsDir := fs.String("srs", "", "directory of the srs files, an unsafe srs is generated if empty")
+	packed := fs.Bool("packed", false, "expose hashes as two 128-bit public variables instead of one per byte, the recursive circuit follows")
+	var a artifacts
+	a.register(fs)
+	_ = fs.Parse(args)
+
+	net, err := circuits.NetworkByName(*networkName)
+	if err != nil {
+		return err
+	}
+	layout := circuits.Layout{Packed: *packed}
+
+	var circuit frontend.Circuit
+	if a.batch == 0 {
+		circuit = circuits.NewBlockHeaderUnitCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](net, layout)
+	} else {
+		circuit = circuits.NewBlockHeaderBatchCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](net, a.batch, layout)
+	}
+
+	ccs, err := operations.NewConstraintSystem(circuit)
+	if err != nil {
+		return err
+	}
+	return setup(ccs, a.leafName(), &a, *srsDir)
+}
+
+func setupRecursive(args []string) error {
+	fs := flag.NewFlagSet("setup-recursive", flag.ExitOnError)
+	srsDir := fs.String("srs", "", "directory of the srs files, an unsafe srs is generated if empty")
+	var a artifacts
+	a.register(fs)
+	_ = fs.Parse(args)
+
+	unitCcs, err := operations.ReadCcs(a.file(a.leafName(), "ccs"))
+	if err != nil {
+		return err
+	}
+
+	unitVk, err := operations.ReadVk(a.file(a.leafName(), "vk"))
+	if err != nil {
+		return err
+	}
+
+	unitVkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](unitVk)
+	if err != nil {
+		return err
+	}
+
+	circuit := circuits.NewBlockHeaderRecursiveCircuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		unitCcs,
+		unitVkFpBytes,
+	)
+
+	ccs, err := operations.NewConstraintSystem(circuit)
+	if err != nil {
+		return err
+	}
+	return setup(ccs, a.recursiveName(), &a, *srsDir)
+}
+
+// setup runs the plonk setup of ccs and writes the ccs, pk and vk as the artifacts named name.
+func setup(ccs constraint.ConstraintSystem, name string, a *artifacts, srsDir string) error {
+	fmt.Printf("nbConstraints:%v, nbPublicWitness:%v, nbSecretWitness:%v, nbInternalVariables:%v\n", ccs.GetNbConstraints(), ccs.GetNbPublicVariables(), ccs.GetNbSecretVariables(), ccs.GetNbInternalVariables())
+
+	srs, lsrs, err := newSRS(ccs, srsDir)
+	if err != nil {
+		return err
+	}
+
+	pk, vk, err := operations.PlonkSetup(ccs, srs, lsrs)
+	if err != nil {
+		return err
+	}
+
+	err = operations.WriteCcs(ccs, a.file(name, "ccs"))
+	if err != nil {
+		return err
+	}
+	err = operations.WritePk(pk, a.file(name, "pk"))
+	if err != nil {
+		return err
+	}
+	err = operations.WriteVk(vk, a.file(name, "vk"))
+	if err != nil {
+		return err
+	}
+
+	vkFpBytes, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("successfully setup %v circuit, vk fingerprint %x\n", name, vkFpBytes)
+	return nil
+}
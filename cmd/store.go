@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/store"
+)
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	storeDir := fs.String("store", "store", "proof store directory")
+	_ = fs.Parse(args)
+
+	st, err := store.Open(*storeDir)
+	if err != nil {
+		return err
+	}
+	entries, err := st.List()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fmt.Printf("%v %8v %8v %v %v\n", entry.VkFp, entry.BeginHeight+1, entry.EndHeight,
+			chainhash.Hash(entry.BeginHash), chainhash.Hash(entry.EndHash))
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/envelope"
+	"github.com/readygo67/BlockHeaderProver/verifier"
+	"os"
+	"strings"
+)
+
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	vkFile := fs.String("vk", "", "verifying key file")
+	proofFile := fs.String("proof", "", "proof file")
+	witnessFile := fs.String("witness", "", "public witness file")
+	envelopeFile := fs.String("envelope", "", "envelope file written by pack, instead of -proof and -witness")
+	begin := fs.String("begin", "", "hash of the block the proven chain must build on, checks a recursive proof against the pinned vk fingerprint")
+	beginHeight := fs.Uint("begin-height", 0, "height of the -begin block")
+	stateFile := fs.String("state", "", "json file of the chain state after the -begin block, defaults to the genesis state if -begin-height is 0")
+	network := networkFlag(fs)
+	vkFp := fs.String("vk-fp", verifier.RecursiveVkFp, "pinned fingerprint of the recursive vk, for -begin")
+	solidity := fs.Bool("solidity", false, "the proof is made for the Solidity verifier, by prove-range -solidity or prove-commitment -solidity, envelopes tell it themselves")
+	_ = fs.Parse(args)
+
+	vk, err := operations.ReadVk(*vkFile)
+	if err != nil {
+		return err
+	}
+
+	var proof native_plonk.Proof
+	var wit witness.Witness
+	if *envelopeFile != "" {
+		e, err := readEnvelope(*envelopeFile)
+		if err != nil {
+			return err
+		}
+		proof, wit, err = e.Open()
+		if err != nil {
+			return err
+		}
+		*solidity = e.Solidity()
+	} else {
+		proof, err = operations.ReadProof(*proofFile)
+		if err != nil {
+			return err
+		}
+		wit, err = operations.ReadWitness(*witnessFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var public *circuits.PublicWitness
+	if *begin != "" {
+		checkpoint, err := readCheckpoint(*network, *begin, uint32(*beginHeight), *stateFile)
+		if err != nil {
+			return err
+		}
+		pinned, err := hex.DecodeString(*vkFp)
+		if err != nil || len(pinned) == 0 {
+			return fmt.Errorf("invalid pinned vk fingerprint %q", *vkFp)
+		}
+		v := verifier.New(pinned)
+		v.Solidity = *solidity
+		public, err = v.Verify(vk, proof, wit, checkpoint)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = operations.PlonkVerify(vk, proof, wit, *solidity)
+		if err != nil {
+			return err
+		}
+		//a proof of the commitment circuit tells only its commitment
+		if c, err := circuits.CommitmentOf(wit); err == nil {
+			fmt.Printf("proof is valid for commitment 0x%064x\n", c)
+			return nil
+		}
+		public, err = circuits.DecodePublicWitness(wit)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("proof is valid for headers %v to %v, %v to %v\n",
+		public.BeginHeight+1, public.EndHeight(), chainhash.Hash(public.BeginHash), chainhash.Hash(public.EndHash))
+	return nil
+}
+
+// readCheckpoint returns the checkpoint of the block hash at height, after which the chain state is
+// the one in stateFile or, at height 0, the genesis state of the network.
+func readCheckpoint(network, hash string, height uint32, stateFile string) (verifier.Checkpoint, error) {
+	net, err := circuits.NetworkByName(network)
+	if err != nil {
+		return verifier.Checkpoint{}, err
+	}
+	beginHash, err := chainhash.NewHashFromStr(hash)
+	if err != nil {
+		return verifier.Checkpoint{}, err
+	}
+
+	checkpoint := verifier.Checkpoint{Hash: *beginHash, Height: height}
+	switch {
+	case stateFile != "":
+		checkpoint.State, err = readState(stateFile)
+		if err != nil {
+			return verifier.Checkpoint{}, err
+		}
+	case height == 0:
+		checkpoint = verifier.GenesisCheckpoint(net)
+		if *beginHash != net.GenesisHash {
+			return verifier.Checkpoint{}, fmt.Errorf("%v is not the %v genesis block", beginHash, net.Name)
+		}
+	default:
+		return verifier.Checkpoint{}, fmt.Errorf("no state file given for begin height %v", height)
+	}
+	return checkpoint, nil
+}
+
+// publicWitnessJson is the printable form of circuits.PublicWitness, hashes are in display order.
+// The states can be fed back to the -state flag of the prove commands.
+type publicWitnessJson struct {
+	Layout      string
+	BeginHash   string
+	EndHash     string
+	ChainWork   string
+	BeginHeight uint32
+	EndHeight   uint32
+	Count       uint32
+	BeginState  circuits.NativeChainState
+	EndState    circuits.NativeChainState
+	MMRRoot     string
+	VkFp        string
+}
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	witnessFile := fs.String("witness", "", "public witness file")
+	_ = fs.Parse(args)
+
+	wit, err := operations.ReadWitness(*witnessFile)
+	if err != nil {
+		return err
+	}
+
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(publicWitnessJson{
+		Layout:      public.Layout.String(),
+		BeginHash:   chainhash.Hash(public.BeginHash).String(),
+		EndHash:     chainhash.Hash(public.EndHash).String(),
+		ChainWork:   public.ChainWork.String(),
+		BeginHeight: public.BeginHeight,
+		EndHeight:   public.EndHeight(),
+		Count:       public.Count,
+		BeginState:  public.BeginState,
+		EndState:    public.EndState,
+		MMRRoot:     public.MMRRoot.String(),
+		VkFp:        hex.EncodeToString(public.VkFp),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func pack(args []string) error {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	network := networkFlag(fs)
+	circuit := fs.String("circuit", "", "name of the circuit of the proof, e.g. block_header_recursive")
+	proofFile := fs.String("proof", "", "proof file")
+	witnessFile := fs.String("witness", "", "public witness file")
+	out := fs.String("out", "", "envelope file, CBOR encoded if it ends in .cbor, JSON otherwise")
+	solidity := fs.Bool("solidity", false, "the proof is made for the Solidity verifier, by prove-range -solidity")
+	_ = fs.Parse(args)
+
+	net, err := circuits.NetworkByName(*network)
+	if err != nil {
+		return err
+	}
+	proof, err := operations.ReadProof(*proofFile)
+	if err != nil {
+		return err
+	}
+	wit, err := operations.ReadWitness(*witnessFile)
+	if err != nil {
+		return err
+	}
+
+	e, err := envelope.New(net, *circuit, proof, wit, *solidity)
+	if err != nil {
+		return err
+	}
+	err = e.Validate()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if strings.HasSuffix(*out, ".cbor") {
+		data, err = e.EncodeCBOR()
+	} else {
+		data, err = e.EncodeJSON()
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, data, 0644)
+}
+
+func readEnvelope(fn string) (*envelope.Envelope, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var e *envelope.Envelope
+	if strings.HasSuffix(fn, ".cbor") {
+		e, err = envelope.DecodeCBOR(data)
+	} else {
+		e, err = envelope.DecodeJSON(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fn, err)
+	}
+	return e, nil
+}
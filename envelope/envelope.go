@@ -0,0 +1,189 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+)
+
+// FormatVersion is the version of the envelope format.
+const FormatVersion = 2
+
+// Transcripts a proof can be made with, they need different verifier options.
+const (
+	NativeTranscript   = "native"   //hash cheap in circuit, for proofs the recursive circuit merges
+	SolidityTranscript = "solidity" //SHA-256, for the Solidity verifier
+)
+
+// Envelope bundles a proof and its public witness with what they prove, so a proof file tells by
+// itself which network, circuit and range it belongs to. Hashes are in display order.
+type Envelope struct {
+	FormatVersion  int    `cbor:"1,keyasint"`
+	CircuitVersion int    `cbor:"2,keyasint"`
+	Circuit        string `cbor:"3,keyasint"` //name of the circuit, e.g. block_header_recursive
+	Network        string `cbor:"4,keyasint"`
+	BeginHash      string `cbor:"5,keyasint"` //hash of the block the range builds on
+	EndHash        string `cbor:"6,keyasint"` //hash of the last block of the range
+	BeginHeight    uint32 `cbor:"7,keyasint"`
+	Count          uint32 `cbor:"8,keyasint"`
+	VkFp           string `cbor:"9,keyasint"` //hex encoded
+	Proof          []byte `cbor:"10,keyasint"`
+	Witness        []byte `cbor:"11,keyasint"` //public witness
+	Transcript     string `cbor:"12,keyasint"` //NativeTranscript or SolidityTranscript
+}
+
+// New wraps proof and the public part of wit, a proof of the circuit named circuit over net. With
+// solidity the proof was made for the Solidity verifier.
+func New(net *circuits.Network, circuit string, proof native_plonk.Proof, wit witness.Witness, solidity bool) (*Envelope, error) {
+	public, err := wit.Public()
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := circuits.DecodePublicWitness(public)
+	if err != nil {
+		return nil, err
+	}
+
+	var proofBuf bytes.Buffer
+	_, err = proof.WriteTo(&proofBuf)
+	if err != nil {
+		return nil, err
+	}
+	witnessBytes, err := public.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := NativeTranscript
+	if solidity {
+		transcript = SolidityTranscript
+	}
+
+	return &Envelope{
+		FormatVersion:  FormatVersion,
+		CircuitVersion: circuits.Version,
+		Circuit:        circuit,
+		Network:        net.Name,
+		BeginHash:      chainhash.Hash(decoded.BeginHash).String(),
+		EndHash:        chainhash.Hash(decoded.EndHash).String(),
+		BeginHeight:    decoded.BeginHeight,
+		Count:          decoded.Count,
+		VkFp:           hex.EncodeToString(decoded.VkFp),
+		Proof:          proofBuf.Bytes(),
+		Witness:        witnessBytes,
+		Transcript:     transcript,
+	}, nil
+}
+
+// Open validates e and returns its proof and public witness.
+func (e *Envelope) Open() (native_plonk.Proof, witness.Witness, error) {
+	if e.FormatVersion != FormatVersion {
+		return nil, nil, fmt.Errorf("envelope format version %v, expected %v", e.FormatVersion, FormatVersion)
+	}
+	if e.CircuitVersion != circuits.Version {
+		return nil, nil, fmt.Errorf("proof of circuit version %v, expected %v", e.CircuitVersion, circuits.Version)
+	}
+	if e.Circuit == "" {
+		return nil, nil, fmt.Errorf("no circuit name")
+	}
+	_, err := circuits.NetworkByName(e.Network)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.Transcript != NativeTranscript && e.Transcript != SolidityTranscript {
+		return nil, nil, fmt.Errorf("unknown proof transcript %q", e.Transcript)
+	}
+
+	proof := native_plonk.NewProof(ecc.BN254)
+	n, err := proof.ReadFrom(bytes.NewReader(e.Proof))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid proof: %v", err)
+	}
+	if n != int64(len(e.Proof)) {
+		return nil, nil, fmt.Errorf("%v trailing bytes after the proof", int64(len(e.Proof))-n)
+	}
+
+	wit, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, nil, err
+	}
+	err = wit.UnmarshalBinary(e.Witness)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid witness: %v", err)
+	}
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//the metadata must tell what the witness says
+	switch {
+	case chainhash.Hash(public.BeginHash).String() != e.BeginHash:
+		return nil, nil, fmt.Errorf("begin hash %v, the witness has %v", e.BeginHash, chainhash.Hash(public.BeginHash))
+	case chainhash.Hash(public.EndHash).String() != e.EndHash:
+		return nil, nil, fmt.Errorf("end hash %v, the witness has %v", e.EndHash, chainhash.Hash(public.EndHash))
+	case public.BeginHeight != e.BeginHeight:
+		return nil, nil, fmt.Errorf("begin height %v, the witness has %v", e.BeginHeight, public.BeginHeight)
+	case public.Count != e.Count:
+		return nil, nil, fmt.Errorf("%v headers, the witness has %v", e.Count, public.Count)
+	case hex.EncodeToString(public.VkFp) != e.VkFp:
+		return nil, nil, fmt.Errorf("vk fingerprint %v, the witness has %x", e.VkFp, public.VkFp)
+	}
+	return proof, wit, nil
+}
+
+// Solidity tells whether the proof of e was made for the Solidity verifier.
+func (e *Envelope) Solidity() bool {
+	return e.Transcript == SolidityTranscript
+}
+
+// Validate checks that e is well formed and its metadata matches its witness.
+func (e *Envelope) Validate() error {
+	_, _, err := e.Open()
+	return err
+}
+
+// EncodeJSON encodes e in indented JSON, the proof and witness are base64 encoded.
+func (e *Envelope) EncodeJSON() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// DecodeJSON decodes and validates an envelope in JSON.
+func DecodeJSON(data []byte) (*Envelope, error) {
+	var e Envelope
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, err
+	}
+	err = e.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// EncodeCBOR encodes e in CBOR, with integer keys for compactness.
+func (e *Envelope) EncodeCBOR() ([]byte, error) {
+	return cbor.Marshal(e)
+}
+
+// DecodeCBOR decodes and validates an envelope in CBOR.
+func DecodeCBOR(data []byte) (*Envelope, error) {
+	var e Envelope
+	err := cbor.Unmarshal(data, &e)
+	if err != nil {
+		return nil, err
+	}
+	err = e.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
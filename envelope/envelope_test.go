@@ -0,0 +1,127 @@
+package envelope
+
+import (
+	"bytes"
+	"github.com/consensys/gnark-crypto/ecc"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/internal/testutil"
+	"testing"
+)
+
+type dummyCircuit struct {
+	X frontend.Variable `gnark:",public"`
+}
+
+func (c *dummyCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), 4)
+	return nil
+}
+
+// testEnvelope wraps a proof of a dummy circuit, standing in for a proof of the headers, with the
+// witness of a batch of the test headers.
+func testEnvelope(t *testing.T) *Envelope {
+	assert := test.NewAssert(t)
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &dummyCircuit{})
+	assert.NoError(err)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	pk, _, err := native_plonk.Setup(ccs, srs, lsrs)
+	assert.NoError(err)
+	dummyWit, err := frontend.NewWitness(&dummyCircuit{X: 2}, ecc.BN254.ScalarField())
+	assert.NoError(err)
+	proof, err := native_plonk.Prove(ccs, pk, dummyWit)
+	assert.NoError(err)
+
+	blockHeaders := testutil.BlockHeaders(t, 2)
+	vkFp := make([]byte, 32)
+	vkFp[31] = 0x2a
+	assignment, err := circuits.NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](circuits.MainNet, blockHeaders, testutil.BeginHeight, testutil.State, vkFp, circuits.ByteLayout)
+	assert.NoError(err)
+	wit, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	assert.NoError(err)
+
+	e, err := New(circuits.MainNet, "block_header_batch_2", proof, wit, false)
+	assert.NoError(err)
+	return e
+}
+
+func TestEnvelope(t *testing.T) {
+	assert := test.NewAssert(t)
+	e := testEnvelope(t)
+
+	assert.Equal("mainnet", e.Network)
+	//blocks 7 and 9, the parent of the first header and the second header, in display order
+	assert.Equal("0000000071966c2b1d065fd446b1e485b2c9d9594acd2007ccbd5441cfc89444", e.BeginHash)
+	assert.Equal("000000008d9dc510f23c2657fc4f67bea30078cc05a90eb89e84cc475c080805", e.EndHash)
+	assert.Equal(uint32(testutil.BeginHeight), e.BeginHeight)
+	assert.Equal(uint32(2), e.Count)
+	assert.Equal(NativeTranscript, e.Transcript)
+	assert.False(e.Solidity())
+	assert.NoError(e.Validate())
+
+	proof, wit, err := e.Open()
+	assert.NoError(err)
+	var proofBuf bytes.Buffer
+	_, err = proof.WriteTo(&proofBuf)
+	assert.NoError(err)
+	assert.Equal(e.Proof, proofBuf.Bytes())
+	public, err := circuits.DecodePublicWitness(wit)
+	assert.NoError(err)
+	assert.Equal(e.Count, public.Count)
+
+	jsonData, err := e.EncodeJSON()
+	assert.NoError(err)
+	decoded, err := DecodeJSON(jsonData)
+	assert.NoError(err)
+	assert.Equal(e, decoded)
+
+	cborData, err := e.EncodeCBOR()
+	assert.NoError(err)
+	decoded, err = DecodeCBOR(cborData)
+	assert.NoError(err)
+	assert.Equal(e, decoded)
+	assert.True(len(cborData) < len(jsonData))
+
+	solidity := *e
+	solidity.Transcript = SolidityTranscript
+	assert.True(solidity.Solidity())
+	assert.NoError(solidity.Validate())
+}
+
+func TestEnvelope_Validate(t *testing.T) {
+	assert := test.NewAssert(t)
+	e := testEnvelope(t)
+
+	for name, tamper := range map[string]func(e *Envelope){
+		"format version":  func(e *Envelope) { e.FormatVersion++ },
+		"circuit version": func(e *Envelope) { e.CircuitVersion++ },
+		"circuit":         func(e *Envelope) { e.Circuit = "" },
+		"network":         func(e *Envelope) { e.Network = "litecoin" },
+		"begin hash":      func(e *Envelope) { e.BeginHash = e.EndHash },
+		"end hash":        func(e *Envelope) { e.EndHash = e.BeginHash },
+		"begin height":    func(e *Envelope) { e.BeginHeight++ },
+		"count":           func(e *Envelope) { e.Count++ },
+		"vk fingerprint":  func(e *Envelope) { e.VkFp = "00" },
+		"proof":           func(e *Envelope) { e.Proof = e.Proof[:len(e.Proof)-1] },
+		"trailing bytes":  func(e *Envelope) { e.Proof = append(e.Proof, 0) },
+		"witness":         func(e *Envelope) { e.Witness = e.Witness[:len(e.Witness)-32] },
+		"transcript":      func(e *Envelope) { e.Transcript = "" },
+	} {
+		tampered := *e
+		tampered.Proof = bytes.Clone(e.Proof)
+		tamper(&tampered)
+		assert.Error(tampered.Validate(), name)
+
+		data, err := tampered.EncodeCBOR()
+		assert.NoError(err)
+		_, err = DecodeCBOR(data)
+		assert.Error(err, name)
+	}
+}
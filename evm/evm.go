@@ -0,0 +1,207 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	plonk_bn254 "github.com/consensys/gnark/backend/plonk/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"golang.org/x/crypto/sha3"
+	"io"
+	"math/big"
+)
+
+// VerifySignature is the signature of the function of the exported verifier contract.
+const VerifySignature = "Verify(bytes,uint256[])"
+
+const wordLen = 32
+
+// VerifySelector is the selector of VerifySignature, the first four bytes of calldata.
+var VerifySelector = selector(VerifySignature)
+
+func selector(signature string) [4]byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(signature))
+	return [4]byte(h.Sum(nil))
+}
+
+// ExportVerifier writes the Solidity PLONK verifier of vk to w. It only accepts proofs made for
+// the Solidity verifier, see prover.Circuit.ProveSolidity, the proofs the recursive circuit merges
+// use another transcript hash.
+func ExportVerifier(vk native_plonk.VerifyingKey, w io.Writer) error {
+	bn254Vk, ok := vk.(*plonk_bn254.VerifyingKey)
+	if !ok {
+		return fmt.Errorf("not a bn254 verifying key")
+	}
+	return bn254Vk.ExportSolidity(w)
+}
+
+// Calldata is the input of a call to Verify of the exported verifier.
+type Calldata struct {
+	Proof        []byte //proof in the layout of plonk_bn254.Proof.MarshalSolidity
+	PublicInputs fr.Vector
+}
+
+// NewCalldata returns the calldata verifying proof with the public inputs of wit, in either layout
+// or of the commitment circuit.
+func NewCalldata(proof native_plonk.Proof, wit witness.Witness) (*Calldata, error) {
+	bn254Proof, ok := proof.(*plonk_bn254.Proof)
+	if !ok {
+		return nil, fmt.Errorf("not a bn254 proof")
+	}
+	public, err := wit.Public()
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := public.Vector().(fr.Vector)
+	if !ok {
+		return nil, fmt.Errorf("witness is not over bn254")
+	}
+	err = checkNbInputs(len(vec))
+	if err != nil {
+		return nil, err
+	}
+	return &Calldata{Proof: bn254Proof.MarshalSolidity(), PublicInputs: vec}, nil
+}
+
+// Encode ABI encodes the call, selector first.
+func (c *Calldata) Encode() []byte {
+	proofWords := (len(c.Proof) + wordLen - 1) / wordLen
+
+	var buf bytes.Buffer
+	buf.Write(VerifySelector[:])
+	//heads: the offsets of proof and public_inputs from the start of the arguments
+	buf.Write(uint256(2 * wordLen))
+	buf.Write(uint256((3 + proofWords) * wordLen))
+	//proof, zero padded to whole words
+	buf.Write(uint256(len(c.Proof)))
+	buf.Write(c.Proof)
+	buf.Write(make([]byte, proofWords*wordLen-len(c.Proof)))
+	//public_inputs
+	buf.Write(uint256(len(c.PublicInputs)))
+	for i := range c.PublicInputs {
+		b := c.PublicInputs[i].Bytes()
+		buf.Write(b[:])
+	}
+	return buf.Bytes()
+}
+
+// DecodeCalldata decodes a call to Verify as encoded by Encode. It rejects any other encoding of
+// the same arguments and public inputs out of the scalar field.
+func DecodeCalldata(data []byte) (*Calldata, error) {
+	if len(data) < len(VerifySelector) || !bytes.Equal(data[:len(VerifySelector)], VerifySelector[:]) {
+		return nil, fmt.Errorf("not a call to %v", VerifySignature)
+	}
+	args := data[len(VerifySelector):]
+
+	word := func(i int) (int, error) {
+		if len(args) < (i+1)*wordLen {
+			return 0, fmt.Errorf("calldata too short")
+		}
+		w := new(big.Int).SetBytes(args[i*wordLen : (i+1)*wordLen])
+		if !w.IsUint64() || w.Uint64() > uint64(len(args)) {
+			return 0, fmt.Errorf("invalid calldata word %v", i)
+		}
+		return int(w.Uint64()), nil
+	}
+
+	proofOffset, err := word(0)
+	if err != nil {
+		return nil, err
+	}
+	inputsOffset, err := word(1)
+	if err != nil {
+		return nil, err
+	}
+	proofLen, err := word(2)
+	if err != nil {
+		return nil, err
+	}
+	proofWords := (proofLen + wordLen - 1) / wordLen
+	if proofOffset != 2*wordLen || inputsOffset != (3+proofWords)*wordLen {
+		return nil, fmt.Errorf("unexpected argument offsets %v and %v", proofOffset, inputsOffset)
+	}
+	nbInputs, err := word(3 + proofWords)
+	if err != nil {
+		return nil, err
+	}
+	err = checkNbInputs(nbInputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != (4+proofWords+nbInputs)*wordLen {
+		return nil, fmt.Errorf("calldata of %v bytes, expected %v", len(data), len(VerifySelector)+(4+proofWords+nbInputs)*wordLen)
+	}
+
+	proof := args[3*wordLen : 3*wordLen+proofLen]
+	padding := args[3*wordLen+proofLen : (3+proofWords)*wordLen]
+	if !bytes.Equal(padding, make([]byte, len(padding))) {
+		return nil, fmt.Errorf("non zero proof padding")
+	}
+
+	inputs := make(fr.Vector, nbInputs)
+	for i := range inputs {
+		offset := (4 + proofWords + i) * wordLen
+		err = inputs[i].SetBytesCanonical(args[offset : offset+wordLen])
+		if err != nil {
+			return nil, fmt.Errorf("public input %v: %v", i, err)
+		}
+	}
+	return &Calldata{Proof: bytes.Clone(proof), PublicInputs: inputs}, nil
+}
+
+// Witness returns the public witness of the public inputs.
+func (c *Calldata) Witness() (witness.Witness, error) {
+	wit, err := witness.New(ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, err
+	}
+	values := make(chan any, len(c.PublicInputs))
+	for i := range c.PublicInputs {
+		values <- c.PublicInputs[i]
+	}
+	close(values)
+	err = wit.Fill(len(c.PublicInputs), 0, values)
+	if err != nil {
+		return nil, err
+	}
+	return wit, nil
+}
+
+// Verify checks natively that c is the calldata of proof and that the Solidity verifier of vk
+// accepts it. The proof cannot be taken back from c, it lacks the opening the contract recomputes.
+func (c *Calldata) Verify(vk native_plonk.VerifyingKey, proof native_plonk.Proof) error {
+	bn254Proof, ok := proof.(*plonk_bn254.Proof)
+	if !ok {
+		return fmt.Errorf("not a bn254 proof")
+	}
+	if !bytes.Equal(bn254Proof.MarshalSolidity(), c.Proof) {
+		return fmt.Errorf("calldata is not of the proof")
+	}
+	wit, err := c.Witness()
+	if err != nil {
+		return err
+	}
+	return operations.PlonkVerify(vk, proof, wit, true)
+}
+
+// checkNbInputs accepts the public inputs of the circuits in either layout and the single one of the
+// commitment circuit.
+func checkNbInputs(nb int) error {
+	if nb == circuits.NbCommitmentPublicVariables {
+		return nil
+	}
+	_, err := circuits.LayoutOf(nb)
+	return err
+}
+
+func uint256(v int) []byte {
+	var b [wordLen]byte
+	binary.BigEndian.PutUint64(b[wordLen-8:], uint64(v))
+	return b[:]
+}
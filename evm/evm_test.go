@@ -0,0 +1,176 @@
+package evm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/internal/testutil"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recursiveArtifacts names the artifacts and unit proofs of the circuits tests in a layout, which
+// the real recursive circuit merges.
+type recursiveArtifacts struct {
+	layout    circuits.Layout
+	nbPublic  int
+	unit      string
+	recursive string
+}
+
+var layoutArtifacts = []recursiveArtifacts{
+	{circuits.ByteLayout, 97, "block_header_unit", "block_header_recursive"},
+	{circuits.PackedLayout, 37, "block_header_unit_packed", "block_header_recursive_packed"},
+}
+
+func TestCalldata(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &testutil.FakeChainCircuit{})
+	assert.NoError(err)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	pk, vk, err := native_plonk.Setup(ccs, srs, lsrs)
+	assert.NoError(err)
+
+	assignment := testutil.NewFakeChainAssignment(t, make([]byte, 32))
+	proof, wit, err := operations.PlonkProve(ccs, pk, assignment, true)
+	assert.NoError(err)
+	assert.NoError(operations.PlonkVerify(vk, proof, wit, true))
+
+	var sol bytes.Buffer
+	assert.NoError(ExportVerifier(vk, &sol))
+	assert.True(strings.Contains(sol.String(), "function Verify(bytes calldata proof, uint256[] calldata public_inputs)"))
+
+	c, err := NewCalldata(proof, wit)
+	assert.NoError(err)
+	data := c.Encode()
+	assert.Equal(0, (len(data)-len(VerifySelector))%wordLen)
+	assert.Equal("7e4f7a8a", hex.EncodeToString(VerifySelector[:]))
+
+	//the decoded calldata verifies natively and carries the public witness of the proof
+	decoded, err := DecodeCalldata(data)
+	assert.NoError(err)
+	assert.Equal(c.Proof, decoded.Proof)
+	assert.NoError(decoded.Verify(vk, proof))
+	decodedWit, err := decoded.Witness()
+	assert.NoError(err)
+	decodedPublic, err := circuits.DecodePublicWitness(decodedWit)
+	assert.NoError(err)
+	expected, err := circuits.DecodePublicWitness(wit)
+	assert.NoError(err)
+	assert.Equal(expected, decodedPublic)
+
+	//a changed public input does not verify
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 1
+	decoded, err = DecodeCalldata(tampered)
+	assert.NoError(err)
+	assert.Error(decoded.Verify(vk, proof))
+
+	//nor does the proof verify for the recursive circuit
+	assert.Error(operations.PlonkVerify(vk, proof, wit, false))
+
+	//malformed calldata
+	for _, data := range [][]byte{
+		nil,
+		data[:len(data)-1],
+		append(bytes.Clone(data), 0),
+		append([]byte{0, 0, 0, 0}, data[4:]...),
+	} {
+		_, err = DecodeCalldata(data)
+		assert.Error(err)
+	}
+	//the single commitment of the commitment circuit is accepted, other counts are not
+	for nb, ok := range map[int]bool{circuits.NbCommitmentPublicVariables: true, 2: false} {
+		_, err = DecodeCalldata((&Calldata{Proof: c.Proof, PublicInputs: c.PublicInputs[:nb]}).Encode())
+		assert.Equal(ok, err == nil)
+	}
+	//a public input out of the field
+	tampered = bytes.Clone(data)
+	for i := len(tampered) - wordLen; i < len(tampered); i++ {
+		tampered[i] = 0xff
+	}
+	_, err = DecodeCalldata(tampered)
+	assert.Error(err)
+}
+
+// readUnitProof reads a unit proof of the circuits tests as the range proof of its single header.
+func readUnitProof(t *testing.T, vk native_plonk.VerifyingKey, name string) *prover.RangeProof {
+	assert := test.NewAssert(t)
+
+	proof, err := operations.ReadProof("../testdata/" + name + ".proof")
+	assert.NoError(err)
+	wit, err := operations.ReadWitness("../testdata/" + name + ".wtns")
+	assert.NoError(err)
+	public, err := circuits.DecodePublicWitness(wit)
+	assert.NoError(err)
+	rp, err := prover.NewRangeProof(vk, proof, wit, circuits.NewMMR([][circuits.HashLen]byte{public.EndHash}))
+	assert.NoError(err)
+	return rp
+}
+
+// the calldata of a proof of the recursive circuit itself, merged for the Solidity verifier, in
+// both layouts
+func TestCalldata_Recursive(t *testing.T) {
+	for _, a := range layoutArtifacts {
+		t.Run(a.recursive, func(t *testing.T) {
+			testCalldataRecursive(t, a)
+		})
+	}
+}
+
+func testCalldataRecursive(t *testing.T, a recursiveArtifacts) {
+	dir := "../testdata/"
+	for _, fn := range []string{
+		a.unit + ".vk", a.recursive + ".ccs", a.recursive + ".pk", a.recursive + ".vk",
+		a.unit + "_0_1.proof", a.unit + "_0_1.wtns", a.unit + "_1_2.proof", a.unit + "_1_2.wtns",
+	} {
+		if _, err := os.Stat(dir + fn); err != nil {
+			t.Skipf("no circuit artifacts: %v", err)
+		}
+	}
+	assert := test.NewAssert(t)
+
+	unitVk, err := operations.ReadVk(dir + a.unit + ".vk")
+	assert.NoError(err)
+	ccs, err := operations.ReadCcs(dir + a.recursive + ".ccs")
+	assert.NoError(err)
+	pk, err := operations.ReadPk(dir + a.recursive + ".pk")
+	assert.NoError(err)
+	vk, err := operations.ReadVk(dir + a.recursive + ".vk")
+	assert.NoError(err)
+	recursive, err := prover.NewCircuit(ccs, pk, vk)
+	assert.NoError(err)
+
+	p := &prover.Prover{Network: circuits.MainNet, Recursive: recursive}
+	merged, err := p.MergeSolidity(readUnitProof(t, unitVk, a.unit+"_0_1"), readUnitProof(t, unitVk, a.unit+"_1_2"))
+	assert.NoError(err)
+	assert.Equal(a.layout, merged.Public.Layout)
+
+	var sol bytes.Buffer
+	assert.NoError(ExportVerifier(vk, &sol))
+
+	c, err := NewCalldata(merged.Proof, merged.Witness)
+	assert.NoError(err)
+	assert.Equal(a.nbPublic, len(c.PublicInputs))
+	decoded, err := DecodeCalldata(c.Encode())
+	assert.NoError(err)
+	assert.Equal(c, decoded)
+	assert.NoError(decoded.Verify(vk, merged.Proof))
+
+	decodedWit, err := decoded.Witness()
+	assert.NoError(err)
+	decodedPublic, err := circuits.DecodePublicWitness(decodedWit)
+	assert.NoError(err)
+	assert.Equal(merged.Public, decodedPublic)
+}
@@ -0,0 +1,238 @@
+package headers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// BlkFileSource serves the best chain stored in the blk*.dat files of a Bitcoin Core blocks
+// directory. Core writes blocks in the order it receives them, which is not the chain order and
+// includes stale blocks, so the whole directory is read up front and the chain is rebuilt from the
+// prev hash of every header. The node should be stopped, or at least not be writing, while the
+// files are read.
+type BlkFileSource struct {
+	chain []Header //chain[h] is the header at height h
+}
+
+var _ Source = (*BlkFileSource)(nil)
+
+// NewBlkFileSource reads the blocks directory of a node of net and rebuilds its best chain, the
+// chain with the most work that starts at the genesis block.
+func NewBlkFileSource(net *circuits.Network, blocksDir string) (*BlkFileSource, error) {
+	key, err := readXorKey(blocksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(blocksDir, "blk*.dat"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no blk*.dat files in %v", blocksDir)
+	}
+	//the file numbers are zero padded
+	slices.Sort(files)
+
+	var headers []Header
+	for _, fn := range files {
+		err = readBlkFile(fn, net.Magic, key, func(header Header) {
+			headers = append(headers, header)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain, err := BestChain(net, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &BlkFileSource{chain: chain}, nil
+}
+
+func (s *BlkFileSource) TipHeight(context.Context) (uint32, error) {
+	return uint32(len(s.chain) - 1), nil
+}
+
+func (s *BlkFileSource) Headers(_ context.Context, height uint32, count int) ([]Header, error) {
+	err := checkRange(height, count, uint32(len(s.chain)-1))
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(s.chain[height : int(height)+count]), nil
+}
+
+// BestChain returns the chain of headers with the most work from the genesis block of net, indexed
+// by height. Headers may come in any order, headers that do not connect to the genesis block are
+// ignored. Among chains of equal work the one whose tip comes first wins, as in Bitcoin Core.
+func BestChain(net *circuits.Network, headers []Header) ([]Header, error) {
+	type entry struct {
+		header Header
+		seq    int
+		height uint32
+		work   *big.Int
+	}
+
+	entries := make(map[chainhash.Hash]*entry, len(headers))
+	children := make(map[chainhash.Hash][]chainhash.Hash, len(headers))
+	for i, header := range headers {
+		hash := chainhash.DoubleHashH(header[:])
+		if _, ok := entries[hash]; ok {
+			continue
+		}
+		entries[hash] = &entry{header: header, seq: i}
+		if hash != net.GenesisHash {
+			children[PrevHash(header)] = append(children[PrevHash(header)], hash)
+		}
+	}
+
+	genesis, ok := entries[net.GenesisHash]
+	if !ok {
+		return nil, fmt.Errorf("genesis block %v not found", net.GenesisHash)
+	}
+
+	//walk the tree of blocks from the genesis block, iteratively since it is as deep as the chain
+	var err error
+	genesis.work, err = circuits.HeaderWork(genesis.header)
+	if err != nil {
+		return nil, err
+	}
+	best := net.GenesisHash
+	queue := []chainhash.Hash{net.GenesisHash}
+	for len(queue) > 0 {
+		parentHash := queue[0]
+		queue = queue[1:]
+		parent := entries[parentHash]
+
+		for _, hash := range children[parentHash] {
+			e := entries[hash]
+			work, err := circuits.HeaderWork(e.header)
+			if err != nil {
+				return nil, fmt.Errorf("block %v: %v", hash, err)
+			}
+			e.height = parent.height + 1
+			e.work = work.Add(work, parent.work)
+
+			b := entries[best]
+			if c := e.work.Cmp(b.work); c > 0 || (c == 0 && e.seq < b.seq) {
+				best = hash
+			}
+			queue = append(queue, hash)
+		}
+	}
+
+	tip := entries[best]
+	chain := make([]Header, tip.height+1)
+	for hash := best; ; {
+		e := entries[hash]
+		chain[e.height] = e.header
+		if e.height == 0 {
+			break
+		}
+		hash = PrevHash(e.header)
+	}
+	return chain, nil
+}
+
+// readBlkFile calls fn with the header of every block of a blk*.dat file. Each block is stored
+// after the network magic and its little endian length.
+func readBlkFile(fn string, magic [4]byte, key []byte, handle func(Header)) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	r := bufio.NewReaderSize(&xorReader{r: f, key: key}, 1<<20)
+	offset := int64(0)
+	for {
+		var prefix [8]byte
+		_, err = io.ReadFull(r, prefix[:])
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		//files are preallocated with zeros, the first zero magic ends the data
+		if [4]byte(prefix[:4]) == [4]byte{} {
+			return nil
+		}
+		if [4]byte(prefix[:4]) != magic {
+			return fmt.Errorf("%v: magic %x at offset %v, expected %x", fn, prefix[:4], offset, magic)
+		}
+
+		size := binary.LittleEndian.Uint32(prefix[4:])
+		if size < circuits.BlockHeaderLen {
+			return fmt.Errorf("%v: block of %v bytes at offset %v", fn, size, offset)
+		}
+
+		var header Header
+		_, err = io.ReadFull(r, header[:])
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			//a block cut short by a crash is not part of the chain
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = r.Discard(int(size) - circuits.BlockHeaderLen)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		handle(header)
+		offset += int64(len(prefix)) + int64(size)
+	}
+}
+
+// readXorKey reads the key Bitcoin Core obfuscates the block files with since v28, the files are
+// stored in clear if the key is missing or zero.
+func readXorKey(blocksDir string) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(blocksDir, "xor.dat"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 || slices.Max(key) == 0 {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// xorReader deobfuscates a block file read from its start.
+type xorReader struct {
+	r      io.Reader
+	key    []byte
+	offset int
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	if len(x.key) > 0 {
+		for i := 0; i < n; i++ {
+			p[i] ^= x.key[(x.offset+i)%len(x.key)]
+		}
+	}
+	x.offset += n
+	return n, err
+}
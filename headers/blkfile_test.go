@@ -0,0 +1,96 @@
+package headers
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeBlkFile stores headers as blocks of a blk*.dat file, each followed by a dummy body, with the
+// preallocated zeros at the end.
+func writeBlkFile(t *testing.T, fn string, key []byte, headers []Header) {
+	var data []byte
+	for i, header := range headers {
+		body := make([]byte, 1+i%7)
+		data = append(data, circuits.RegTest.Magic[:]...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(header)+len(body)))
+		data = append(data, header[:]...)
+		data = append(data, body...)
+	}
+	data = append(data, make([]byte, 64)...)
+
+	for i := range data {
+		if len(key) > 0 {
+			data[i] ^= key[i%len(key)]
+		}
+	}
+	err := os.WriteFile(fn, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlkFileSource(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 10)
+	stale := extend(chain[5], 3, 1)
+
+	//blocks come out of order across files, with a stale branch and obfuscated files
+	dir := t.TempDir()
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	assert.NoError(os.WriteFile(filepath.Join(dir, "xor.dat"), key, 0644))
+	writeBlkFile(t, filepath.Join(dir, "blk00000.dat"), key, []Header{chain[0], chain[1], chain[3], chain[2], stale[0], chain[4]})
+	writeBlkFile(t, filepath.Join(dir, "blk00001.dat"), key, []Header{chain[5], stale[2], stale[1], chain[7], chain[6], chain[8], chain[10], chain[9]})
+
+	source, err := NewBlkFileSource(circuits.RegTest, dir)
+	assert.NoError(err)
+
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(10), tip)
+
+	headers, err := source.Headers(ctx, 1, 10)
+	assert.NoError(err)
+	assert.Equal(chain[1:], headers)
+
+	_, err = source.Headers(ctx, 5, 7)
+	assert.Error(err)
+}
+
+func TestBlkFileSource_Reorg(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 6)
+	fork := extend(chain[3], 4, 1)
+
+	dir := t.TempDir()
+	writeBlkFile(t, filepath.Join(dir, "blk00000.dat"), nil, append(chain, fork...))
+
+	source, err := NewBlkFileSource(circuits.RegTest, dir)
+	assert.NoError(err)
+
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(7), tip)
+
+	headers, err := source.Headers(ctx, 3, 5)
+	assert.NoError(err)
+	assert.Equal(append([]Header{chain[3]}, fork...), headers)
+}
+
+func TestBlkFileSource_WrongNetwork(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	dir := t.TempDir()
+	writeBlkFile(t, filepath.Join(dir, "blk00000.dat"), nil, testChain(t, 2))
+
+	_, err := NewBlkFileSource(circuits.MainNet, dir)
+	assert.Error(err)
+}
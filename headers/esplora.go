@@ -0,0 +1,178 @@
+package headers
+
+import (
+	"context"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/lightec-xyz/common/operations"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EsploraConfig configures the connection of an EsploraSource to an Esplora or Electrs REST API.
+type EsploraConfig struct {
+	URL         string       //base url of the API, e.g. https://blockstream.info/api
+	Concurrency int          //requests in flight at once, defaults to DefaultEsploraConcurrency
+	CacheSize   int          //headers kept in memory, defaults to DefaultEsploraCacheSize
+	Client      *http.Client //defaults to http.DefaultClient
+}
+
+const (
+	DefaultEsploraConcurrency = 8
+	DefaultEsploraCacheSize   = 100_000
+
+	// blocks this deep below the tip are taken as final, their hash is cached by height
+	confirmedDepth = 100
+)
+
+// EsploraSource fetches headers from the REST API of Esplora, resolving heights by
+// /block-height/:height and fetching raw headers by /block/:hash/header. Headers are cached by hash,
+// and the hashes of deeply confirmed blocks by height.
+type EsploraSource struct {
+	cfg     EsploraConfig
+	headers *operations.LRUCache //block hash to header
+	hashes  *operations.LRUCache //height to block hash
+}
+
+var _ Source = (*EsploraSource)(nil)
+
+func NewEsploraSource(cfg EsploraConfig) (*EsploraSource, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("no esplora url")
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultEsploraConcurrency
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultEsploraCacheSize
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &EsploraSource{
+		cfg:     cfg,
+		headers: operations.NewLRUCache(cfg.CacheSize),
+		hashes:  operations.NewLRUCache(cfg.CacheSize),
+	}, nil
+}
+
+func (s *EsploraSource) TipHeight(ctx context.Context) (uint32, error) {
+	body, err := s.get(ctx, "/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseUint(body, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tip height %q", body)
+	}
+	return uint32(height), nil
+}
+
+func (s *EsploraSource) Headers(ctx context.Context, height uint32, count int) ([]Header, error) {
+	tip, err := s.TipHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRange(height, count, tip)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make([]Header, count)
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.cfg.Concurrency)
+	for i := range headers {
+		g.Go(func() error {
+			h := height + uint32(i)
+			hash, err := s.blockHash(ctx, h, h+confirmedDepth <= tip)
+			if err != nil {
+				return err
+			}
+			headers[i], err = s.header(ctx, hash)
+			return err
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	//heights resolved across a reorg show up as a break of the chain
+	err = CheckLinkage(PrevHash(headers[0]), headers)
+	if err != nil {
+		return nil, fmt.Errorf("chain changed while fetching headers: %v", err)
+	}
+	return headers, nil
+}
+
+func (s *EsploraSource) blockHash(ctx context.Context, height uint32, isConfirmed bool) (chainhash.Hash, error) {
+	key := strconv.FormatUint(uint64(height), 10)
+	if hash, ok := s.hashes.Get(key); ok {
+		return hash.(chainhash.Hash), nil
+	}
+
+	body, err := s.get(ctx, "/block-height/"+key)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	hash, err := chainhash.NewHashFromStr(body)
+	if err != nil {
+		return chainhash.Hash{}, fmt.Errorf("invalid hash of block %v: %v", height, err)
+	}
+
+	if isConfirmed {
+		s.hashes.Put(key, *hash)
+	}
+	return *hash, nil
+}
+
+func (s *EsploraSource) header(ctx context.Context, hash chainhash.Hash) (Header, error) {
+	key := hash.String()
+	if header, ok := s.headers.Get(key); ok {
+		return header.(Header), nil
+	}
+
+	body, err := s.get(ctx, "/block/"+key+"/header")
+	if err != nil {
+		return Header{}, err
+	}
+	header, err := decodeHeader(body)
+	if err != nil {
+		return Header{}, fmt.Errorf("block %v: %v", hash, err)
+	}
+	if chainhash.DoubleHashH(header[:]) != hash {
+		return Header{}, fmt.Errorf("header of block %v hashes to %v", hash, chainhash.DoubleHashH(header[:]))
+	}
+
+	s.headers.Put(key, header)
+	return header, nil
+}
+
+// get returns the trimmed text body of a successful GET of path.
+func (s *EsploraSource) get(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	body := strings.TrimSpace(string(data))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %v: %v: %v", path, resp.Status, body)
+	}
+	return body, nil
+}
@@ -0,0 +1,121 @@
+package headers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/test"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockEsplora serves the endpoints EsploraSource uses over a fixture chain, it records how many
+// requests were served and how many were in flight at most.
+type mockEsplora struct {
+	chain []Header
+
+	mu          sync.Mutex
+	requests    map[string]int //requests by endpoint, "height" or "header"
+	inFlight    int
+	maxInFlight int
+}
+
+func newMockEsplora(t *testing.T, chain []Header) (*mockEsplora, string) {
+	m := &mockEsplora{chain: chain, requests: make(map[string]int)}
+	server := httptest.NewServer(m)
+	t.Cleanup(server.Close)
+	return m, server.URL
+}
+
+func (m *mockEsplora) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.inFlight++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+	//let requests overlap
+	time.Sleep(time.Millisecond)
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(path) == 3 && path[0] == "blocks" && path[1] == "tip" && path[2] == "height":
+		_, _ = fmt.Fprint(w, len(m.chain)-1)
+	case len(path) == 2 && path[0] == "block-height":
+		m.count("height")
+		height, err := strconv.Atoi(path[1])
+		if err != nil || height < 0 || height >= len(m.chain) {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprint(w, chainhash.DoubleHashH(m.chain[height][:]).String())
+	case len(path) == 3 && path[0] == "block" && path[2] == "header":
+		m.count("header")
+		for _, header := range m.chain {
+			if chainhash.DoubleHashH(header[:]).String() == path[1] {
+				_, _ = fmt.Fprint(w, hex.EncodeToString(header[:]))
+				return
+			}
+		}
+		http.Error(w, "Block not found", http.StatusNotFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *mockEsplora) count(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[endpoint]++
+}
+
+func (m *mockEsplora) stats() (int, int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests["height"], m.requests["header"], m.maxInFlight
+}
+
+func TestEsploraSource(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 150)
+	esplora, url := newMockEsplora(t, chain)
+
+	source, err := NewEsploraSource(EsploraConfig{URL: url + "/", Concurrency: 3})
+	assert.NoError(err)
+
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(150), tip)
+
+	headers, err := source.Headers(ctx, 1, 150)
+	assert.NoError(err)
+	assert.Equal(chain[1:], headers)
+
+	heights, headerCount, maxInFlight := esplora.stats()
+	assert.Equal(150, heights)
+	assert.Equal(150, headerCount)
+	assert.True(maxInFlight <= 3, "%v requests in flight", maxInFlight)
+
+	//headers come from the cache, and the heights of the confirmed ones too
+	headers, err = source.Headers(ctx, 1, 150)
+	assert.NoError(err)
+	assert.Equal(chain[1:], headers)
+
+	heights, headerCount, _ = esplora.stats()
+	assert.Equal(150+confirmedDepth, heights)
+	assert.Equal(150, headerCount)
+
+	_, err = source.Headers(ctx, 100, 52)
+	assert.Error(err)
+}
@@ -0,0 +1,490 @@
+package headers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	ProtocolVersion = 70016
+	// MaxHeadersPerMsg is the most headers a peer sends in one headers message.
+	MaxHeadersPerMsg = 2000
+
+	messageHeaderLen = 24
+	maxPayloadLen    = 4_000_000
+)
+
+// P2PConfig configures the peer a P2PSource syncs from.
+type P2PConfig struct {
+	Address   string        //host or host:port, the port defaults to the one of the network
+	Timeout   time.Duration //for connecting and for every reply of the peer, defaults to DefaultP2PTimeout
+	UserAgent string
+}
+
+const DefaultP2PTimeout = 30 * time.Second
+
+// P2PSource syncs the header chain from a single peer over the Bitcoin P2P protocol, with the
+// version/verack handshake and a getheaders/headers loop from the genesis block. The chain is synced
+// on first use, headers are checked for linkage and proof of work as they come in. A branch of the
+// peer only replaces blocks of the chain once it has more work than them.
+type P2PSource struct {
+	network *circuits.Network
+	cfg     P2PConfig
+	chain   []Header //chain[h] is the header at height h
+	synced  bool
+}
+
+var _ Source = (*P2PSource)(nil)
+
+func NewP2PSource(network *circuits.Network, cfg P2PConfig) (*P2PSource, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("no peer address")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Address); err != nil {
+		cfg.Address = net.JoinHostPort(cfg.Address, strconv.Itoa(int(network.DefaultPort)))
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultP2PTimeout
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "/BlockHeaderProver:0.1/"
+	}
+	return &P2PSource{network: network, cfg: cfg}, nil
+}
+
+func (s *P2PSource) TipHeight(ctx context.Context) (uint32, error) {
+	err := s.ensureSynced(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(len(s.chain) - 1), nil
+}
+
+func (s *P2PSource) Headers(ctx context.Context, height uint32, count int) ([]Header, error) {
+	err := s.ensureSynced(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRange(height, count, uint32(len(s.chain)-1))
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(s.chain[height : int(height)+count]), nil
+}
+
+func (s *P2PSource) ensureSynced(ctx context.Context) error {
+	if s.synced {
+		return nil
+	}
+	return s.Sync(ctx)
+}
+
+// Sync connects to the peer and downloads headers until the peer has no more to give.
+func (s *P2PSource) Sync(ctx context.Context) error {
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	//unblock reads and writes when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	p := &peer{conn: conn, magic: s.network.Magic, timeout: s.cfg.Timeout}
+	err = p.handshake(s.cfg.UserAgent)
+	if err != nil {
+		return s.wrap(ctx, err)
+	}
+
+	if len(s.chain) == 0 {
+		genesis, err := p.genesis(s.network)
+		if err != nil {
+			return s.wrap(ctx, err)
+		}
+		s.chain = []Header{genesis}
+	}
+
+	//the chain of the peer, which shares its first fork blocks with s.chain
+	chain, fork := s.chain, len(s.chain)
+	for {
+		err = p.send("getheaders", encodeGetHeaders(BlockLocator(chain), chainhash.Hash{}))
+		if err != nil {
+			return s.wrap(ctx, err)
+		}
+		headers, err := p.receiveHeaders()
+		if err != nil {
+			return s.wrap(ctx, err)
+		}
+		if len(headers) == 0 {
+			break
+		}
+
+		var height int
+		chain, height, err = s.connect(chain, headers)
+		if err != nil {
+			return fmt.Errorf("peer %v: %v", s.cfg.Address, err)
+		}
+		fork = min(fork, height+1)
+		adopted, err := s.adopt(chain, fork)
+		if err != nil {
+			return fmt.Errorf("peer %v: %v", s.cfg.Address, err)
+		}
+		if adopted {
+			fork = len(chain)
+		}
+		if len(headers) < MaxHeadersPerMsg {
+			break
+		}
+	}
+	s.synced = true
+	return nil
+}
+
+func (s *P2PSource) wrap(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("peer %v: %v", s.cfg.Address, err)
+}
+
+// connect returns chain with headers appended after their parent, which may be any block of chain,
+// and the height of the parent. The blocks of chain above the parent are left out, chain itself is
+// not modified.
+func (s *P2PSource) connect(chain []Header, headers []Header) ([]Header, int, error) {
+	parent := PrevHash(headers[0])
+	height := len(chain) - 1
+	for ; height >= 0; height-- {
+		if chainhash.DoubleHashH(chain[height][:]) == parent {
+			break
+		}
+	}
+	if height < 0 {
+		return nil, 0, fmt.Errorf("headers do not connect to the chain")
+	}
+
+	err := CheckLinkage(parent, headers)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, header := range headers {
+		err = circuits.CheckProofOfWork(s.network, header)
+		if err != nil {
+			return nil, 0, fmt.Errorf("header %v: %v", height+1+i, err)
+		}
+	}
+
+	if height+1 < len(chain) {
+		chain = slices.Clone(chain[:height+1])
+	}
+	return append(chain, headers...), height, nil
+}
+
+// adopt switches to chain, whose first fork blocks are those of the current chain, if it has more
+// work than the current chain. As in BestChain, the current chain stays among chains of equal work.
+func (s *P2PSource) adopt(chain []Header, fork int) (bool, error) {
+	if fork == len(s.chain) {
+		s.chain = chain
+		return true, nil
+	}
+
+	work, err := chainWork(chain[fork:])
+	if err != nil {
+		return false, err
+	}
+	current, err := chainWork(s.chain[fork:])
+	if err != nil {
+		return false, err
+	}
+	if work.Cmp(current) <= 0 {
+		return false, nil
+	}
+	s.chain = chain
+	return true, nil
+}
+
+// chainWork returns the total work of headers.
+func chainWork(headers []Header) (*big.Int, error) {
+	total := big.NewInt(0)
+	for _, header := range headers {
+		work, err := circuits.HeaderWork(header)
+		if err != nil {
+			return nil, err
+		}
+		total.Add(total, work)
+	}
+	return total, nil
+}
+
+// BlockLocator returns the hashes of the locator of chain, dense near the tip and exponentially
+// sparser towards the genesis block which is always included, as in Bitcoin Core.
+func BlockLocator(chain []Header) []chainhash.Hash {
+	var locator []chainhash.Hash
+	step := 1
+	for height := len(chain) - 1; ; height -= step {
+		if height <= 0 {
+			locator = append(locator, chainhash.DoubleHashH(chain[0][:]))
+			return locator
+		}
+		locator = append(locator, chainhash.DoubleHashH(chain[height][:]))
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+}
+
+// encodeGetHeaders asks for the headers after the first block of locator the peer knows, up to
+// stop or as many as fit in a message if stop is zero.
+func encodeGetHeaders(locator []chainhash.Hash, stop chainhash.Hash) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(ProtocolVersion))
+	writeVarInt(&buf, uint64(len(locator)))
+	for _, hash := range locator {
+		buf.Write(hash[:])
+	}
+	buf.Write(stop[:])
+	return buf.Bytes()
+}
+
+func decodeHeaders(payload []byte) ([]Header, error) {
+	r := bytes.NewReader(payload)
+	count, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > MaxHeadersPerMsg {
+		return nil, fmt.Errorf("%v headers in one message", count)
+	}
+
+	headers := make([]Header, count)
+	for i := range headers {
+		_, err = io.ReadFull(r, headers[i][:])
+		if err != nil {
+			return nil, err
+		}
+		//headers come with the transaction count of an empty block
+		txCount, err := readVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		if txCount != 0 {
+			return nil, fmt.Errorf("header %v with %v transactions", i, txCount)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%v trailing bytes in headers message", r.Len())
+	}
+	return headers, nil
+}
+
+// peer speaks the message framing of the P2P protocol on a connection.
+type peer struct {
+	conn    net.Conn
+	magic   [4]byte
+	timeout time.Duration
+}
+
+func (p *peer) handshake(userAgent string) error {
+	err := p.send("version", encodeVersion(userAgent))
+	if err != nil {
+		return err
+	}
+
+	var gotVersion, gotVerack bool
+	for !gotVersion || !gotVerack {
+		command, payload, err := p.receive()
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "version":
+			if len(payload) < 4 {
+				return fmt.Errorf("short version message")
+			}
+			//getheaders came with protocol version 31800
+			if version := binary.LittleEndian.Uint32(payload); version < 31800 {
+				return fmt.Errorf("peer protocol version %v too old", version)
+			}
+			gotVersion = true
+			err = p.send("verack", nil)
+			if err != nil {
+				return err
+			}
+		case "verack":
+			gotVerack = true
+		}
+	}
+	return nil
+}
+
+// genesis asks the peer for the header of the genesis block, which no reply to a locator includes.
+// A getheaders with an empty locator returns the header of its stop hash alone.
+func (p *peer) genesis(network *circuits.Network) (Header, error) {
+	err := p.send("getheaders", encodeGetHeaders(nil, network.GenesisHash))
+	if err != nil {
+		return Header{}, err
+	}
+	headers, err := p.receiveHeaders()
+	if err != nil {
+		return Header{}, err
+	}
+	if len(headers) != 1 || chainhash.DoubleHashH(headers[0][:]) != network.GenesisHash {
+		return Header{}, fmt.Errorf("peer did not return the %v genesis header", network.Name)
+	}
+	return headers[0], nil
+}
+
+func (p *peer) send(command string, payload []byte) error {
+	msg := make([]byte, messageHeaderLen, messageHeaderLen+len(payload))
+	copy(msg[0:4], p.magic[:])
+	copy(msg[4:16], command)
+	binary.LittleEndian.PutUint32(msg[16:20], uint32(len(payload)))
+	checksum := chainhash.DoubleHashB(payload)
+	copy(msg[20:24], checksum[:4])
+	msg = append(msg, payload...)
+
+	err := p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	if err != nil {
+		return err
+	}
+	_, err = p.conn.Write(msg)
+	return err
+}
+
+// receive returns the next message from the peer, answering pings on the way.
+func (p *peer) receive() (string, []byte, error) {
+	for {
+		err := p.conn.SetReadDeadline(time.Now().Add(p.timeout))
+		if err != nil {
+			return "", nil, err
+		}
+
+		var header [messageHeaderLen]byte
+		_, err = io.ReadFull(p.conn, header[:])
+		if err != nil {
+			return "", nil, err
+		}
+		if [4]byte(header[0:4]) != p.magic {
+			return "", nil, fmt.Errorf("message with magic %x, expected %x", header[0:4], p.magic)
+		}
+		command := string(bytes.TrimRight(header[4:16], "\x00"))
+		size := binary.LittleEndian.Uint32(header[16:20])
+		if size > maxPayloadLen {
+			return "", nil, fmt.Errorf("%v message of %v bytes", command, size)
+		}
+
+		payload := make([]byte, size)
+		_, err = io.ReadFull(p.conn, payload)
+		if err != nil {
+			return "", nil, err
+		}
+		checksum := chainhash.DoubleHashB(payload)
+		if !bytes.Equal(checksum[:4], header[20:24]) {
+			return "", nil, fmt.Errorf("%v message with bad checksum", command)
+		}
+
+		if command == "ping" {
+			err = p.send("pong", payload)
+			if err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		return command, payload, nil
+	}
+}
+
+// receiveHeaders waits for the reply to getheaders, skipping unrelated messages.
+func (p *peer) receiveHeaders() ([]Header, error) {
+	for {
+		command, payload, err := p.receive()
+		if err != nil {
+			return nil, err
+		}
+		if command == "headers" {
+			return decodeHeaders(payload)
+		}
+	}
+}
+
+func encodeVersion(userAgent string) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, int32(ProtocolVersion))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(0)) //no services
+	_ = binary.Write(&buf, binary.LittleEndian, time.Now().Unix())
+	//addresses of the peer and of ours, unknown and unroutable
+	for i := 0; i < 2; i++ {
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(0))
+		buf.Write(make([]byte, 16+2))
+	}
+	var nonce [8]byte
+	_, _ = rand.Read(nonce[:])
+	buf.Write(nonce[:])
+	writeVarInt(&buf, uint64(len(userAgent)))
+	buf.WriteString(userAgent)
+	_ = binary.Write(&buf, binary.LittleEndian, int32(0)) //start height
+	buf.WriteByte(0)                                      //no transaction relay
+	return buf.Bytes()
+}
+
+func writeVarInt(w *bytes.Buffer, v uint64) {
+	switch {
+	case v < 0xfd:
+		w.WriteByte(byte(v))
+	case v <= 0xffff:
+		w.WriteByte(0xfd)
+		_ = binary.Write(w, binary.LittleEndian, uint16(v))
+	case v <= 0xffffffff:
+		w.WriteByte(0xfe)
+		_ = binary.Write(w, binary.LittleEndian, uint32(v))
+	default:
+		w.WriteByte(0xff)
+		_ = binary.Write(w, binary.LittleEndian, v)
+	}
+}
+
+func readVarInt(r io.ByteReader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	size := 0
+	switch prefix {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(prefix), nil
+	}
+
+	v := uint64(0)
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b) << (8 * i)
+	}
+	return v, nil
+}
@@ -0,0 +1,196 @@
+package headers
+
+import (
+	"bytes"
+	"context"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedPeer plays the part of a Bitcoin node serving chain to P2PSource.
+type scriptedPeer struct {
+	chain      []Header
+	getHeaders atomic.Int32 //getheaders messages served
+}
+
+func startScriptedPeer(t *testing.T, chain []Header) (*scriptedPeer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	s := &scriptedPeer{chain: chain}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, listener.Addr().String()
+}
+
+func (s *scriptedPeer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	p := &peer{conn: conn, magic: circuits.RegTest.Magic, timeout: 5 * time.Second}
+
+	command, _, err := p.receive()
+	if err != nil || command != "version" {
+		return
+	}
+	//the messages of a recent node between version and verack, and a ping to be answered
+	for _, command := range []string{"version", "wtxidrelay", "sendaddrv2", "verack", "sendheaders", "ping"} {
+		payload := []byte{}
+		switch command {
+		case "version":
+			payload = encodeVersion("/scripted:0.1/")
+		case "ping":
+			payload = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		}
+		if p.send(command, payload) != nil {
+			return
+		}
+	}
+
+	for {
+		command, payload, err := p.receive()
+		if err != nil {
+			return
+		}
+		if command != "getheaders" {
+			continue
+		}
+		s.getHeaders.Add(1)
+
+		locator, stop := decodeGetHeaders(payload)
+		var headers []Header
+		if len(locator) == 0 {
+			for _, header := range s.chain {
+				if chainhash.DoubleHashH(header[:]) == stop {
+					headers = append(headers, header)
+				}
+			}
+		} else {
+			headers = s.headersAfter(locator)
+		}
+
+		var buf bytes.Buffer
+		writeVarInt(&buf, uint64(len(headers)))
+		for _, header := range headers {
+			buf.Write(header[:])
+			buf.WriteByte(0)
+		}
+		if p.send("headers", buf.Bytes()) != nil {
+			return
+		}
+	}
+}
+
+func (s *scriptedPeer) headersAfter(locator []chainhash.Hash) []Header {
+	for _, hash := range locator {
+		for height, header := range s.chain {
+			if chainhash.DoubleHashH(header[:]) == hash {
+				end := min(height+1+MaxHeadersPerMsg, len(s.chain))
+				return s.chain[height+1 : end]
+			}
+		}
+	}
+	return nil
+}
+
+func decodeGetHeaders(payload []byte) ([]chainhash.Hash, chainhash.Hash) {
+	r := bytes.NewReader(payload[4:])
+	count, _ := readVarInt(r)
+	locator := make([]chainhash.Hash, count)
+	for i := range locator {
+		_, _ = r.Read(locator[i][:])
+	}
+	var stop chainhash.Hash
+	_, _ = r.Read(stop[:])
+	return locator, stop
+}
+
+func TestP2PSource(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 2*MaxHeadersPerMsg+500)
+	peer, addr := startScriptedPeer(t, chain)
+
+	source, err := NewP2PSource(circuits.RegTest, P2PConfig{Address: addr, Timeout: 5 * time.Second})
+	assert.NoError(err)
+
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(len(chain)-1), tip)
+	//the genesis header, then two full messages and the rest
+	assert.Equal(int32(4), peer.getHeaders.Load())
+
+	headers, err := source.Headers(ctx, 1, len(chain)-1)
+	assert.NoError(err)
+	assert.Equal(chain[1:], headers)
+}
+
+func TestP2PSource_BrokenChain(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	chain := testChain(t, 10)
+	chain[5], chain[6] = chain[6], chain[5]
+	_, addr := startScriptedPeer(t, chain)
+
+	source, err := NewP2PSource(circuits.RegTest, P2PConfig{Address: addr, Timeout: 5 * time.Second})
+	assert.NoError(err)
+	_, err = source.TipHeight(context.Background())
+	assert.Error(err)
+}
+
+func TestP2PSource_Fork(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	//the peer branches off at height 10, all regtest headers carry the same work
+	chain := testChain(t, MaxHeadersPerMsg+100)
+	for _, n := range []int{50, MaxHeadersPerMsg + 90, MaxHeadersPerMsg + 91} {
+		branch := append(slices.Clone(chain[:11]), extend(chain[10], n, 1)...)
+		_, addr := startScriptedPeer(t, branch)
+
+		source, err := NewP2PSource(circuits.RegTest, P2PConfig{Address: addr, Timeout: 5 * time.Second})
+		assert.NoError(err)
+		source.chain = slices.Clone(chain)
+		err = source.Sync(ctx)
+		assert.NoError(err)
+
+		//the branch replaces the chain only with more work, even if its first message has less
+		expected := chain
+		if len(branch) > len(chain) {
+			expected = branch
+		}
+		assert.Equal(expected, source.chain, n)
+	}
+}
+
+func TestBlockLocator(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	chain := testChain(t, 100)
+	locator := BlockLocator(chain)
+
+	heights := []int{100, 99, 98, 97, 96, 95, 94, 93, 92, 91, 90, 88, 84, 76, 60, 28, 0}
+	assert.Equal(len(heights), len(locator))
+	for i, height := range heights {
+		assert.Equal(chainhash.DoubleHashH(chain[height][:]), locator[i])
+	}
+}
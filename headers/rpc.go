@@ -0,0 +1,263 @@
+package headers
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RPCConfig configures the connection of an RPCSource to bitcoind.
+type RPCConfig struct {
+	URL        string //e.g. http://127.0.0.1:8332
+	User       string
+	Password   string
+	CookieFile string        //.cookie file of bitcoind, used instead of User and Password if set
+	BatchSize  int           //calls per JSON-RPC batch, defaults to DefaultRPCBatchSize
+	Retries    int           //retries of a failed request, transport errors and 5xx responses only
+	RetryDelay time.Duration //delay before the first retry, doubled for every further retry
+	Client     *http.Client  //defaults to http.DefaultClient
+}
+
+const DefaultRPCBatchSize = 500
+
+// RPCSource fetches headers from the JSON-RPC interface of bitcoind, by getblockhash and
+// getblockheader with verbose=false, batching the calls of a range of heights.
+type RPCSource struct {
+	cfg RPCConfig
+}
+
+var _ Source = (*RPCSource)(nil)
+
+func NewRPCSource(cfg RPCConfig) (*RPCSource, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("no rpc url")
+	}
+	if cfg.CookieFile != "" {
+		cookie, err := os.ReadFile(cfg.CookieFile)
+		if err != nil {
+			return nil, err
+		}
+		user, password, ok := strings.Cut(strings.TrimSpace(string(cookie)), ":")
+		if !ok {
+			return nil, fmt.Errorf("%v: invalid cookie", cfg.CookieFile)
+		}
+		cfg.User, cfg.Password = user, password
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultRPCBatchSize
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &RPCSource{cfg: cfg}, nil
+}
+
+func (s *RPCSource) TipHeight(ctx context.Context) (uint32, error) {
+	var height uint32
+	err := s.call(ctx, []rpcRequest{{Method: "getblockcount"}}, []any{&height})
+	return height, err
+}
+
+func (s *RPCSource) Headers(ctx context.Context, height uint32, count int) ([]Header, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid header count %v", count)
+	}
+
+	headers := make([]Header, 0, count)
+	for begin := 0; begin < count; begin += s.cfg.BatchSize {
+		n := min(s.cfg.BatchSize, count-begin)
+
+		hashes := make([]string, n)
+		requests := make([]rpcRequest, n)
+		results := make([]any, n)
+		for i := range requests {
+			requests[i] = rpcRequest{Method: "getblockhash", Params: []any{height + uint32(begin+i)}}
+			results[i] = &hashes[i]
+		}
+		err := s.call(ctx, requests, results)
+		if err != nil {
+			return nil, err
+		}
+
+		raws := make([]string, n)
+		for i := range requests {
+			requests[i] = rpcRequest{Method: "getblockheader", Params: []any{hashes[i], false}}
+			results[i] = &raws[i]
+		}
+		err = s.call(ctx, requests, results)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, raw := range raws {
+			header, err := decodeHeader(raw)
+			if err != nil {
+				return nil, fmt.Errorf("block %v: %v", hashes[i], err)
+			}
+			if hash := chainhash.DoubleHashH(header[:]); hash.String() != hashes[i] {
+				return nil, fmt.Errorf("header of block %v hashes to %v", hashes[i], hash)
+			}
+			headers = append(headers, header)
+		}
+	}
+
+	//a reorg between the calls shows up as a break of the chain
+	err := CheckLinkage(PrevHash(headers[0]), headers)
+	if err != nil {
+		return nil, fmt.Errorf("chain changed while fetching headers: %v", err)
+	}
+	return headers, nil
+}
+
+func decodeHeader(raw string) (Header, error) {
+	data, err := hex.DecodeString(raw)
+	if err != nil {
+		return Header{}, err
+	}
+	if len(data) != circuits.BlockHeaderLen {
+		return Header{}, fmt.Errorf("header of %v bytes", len(data))
+	}
+	return Header(data), nil
+}
+
+type rpcRequest struct {
+	JsonRPC string `json:"jsonrpc"`
+	Id      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	Id     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// RPCError is an error returned by bitcoind for a call.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %v: %v", e.Code, e.Message)
+}
+
+// call sends requests as one batch and decodes the result of requests[i] into results[i].
+func (s *RPCSource) call(ctx context.Context, requests []rpcRequest, results []any) error {
+	for i := range requests {
+		requests[i].JsonRPC = "1.0"
+		requests[i].Id = i
+		if requests[i].Params == nil {
+			requests[i].Params = []any{}
+		}
+	}
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+
+	var responses []rpcResponse
+	delay := s.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		responses, err = s.post(ctx, body)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= s.cfg.Retries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(responses) != len(requests) {
+		return fmt.Errorf("%v responses to %v requests", len(responses), len(requests))
+	}
+	seen := make([]bool, len(requests))
+	for _, response := range responses {
+		if response.Id < 0 || response.Id >= len(requests) || seen[response.Id] {
+			return fmt.Errorf("unexpected response id %v", response.Id)
+		}
+		seen[response.Id] = true
+
+		request := requests[response.Id]
+		if response.Error != nil {
+			return fmt.Errorf("%v %v: %w", request.Method, request.Params, response.Error)
+		}
+		err = json.Unmarshal(response.Result, results[response.Id])
+		if err != nil {
+			return fmt.Errorf("%v %v: %v", request.Method, request.Params, err)
+		}
+	}
+	return nil
+}
+
+// retryableError marks failures that may go away on their own, like a full work queue.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (s *RPCSource) post(ctx context.Context, body []byte) ([]rpcResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.User != "" || s.cfg.Password != "" {
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retryableError{err}
+	}
+
+	//bitcoind answers a batch with 200 and puts the errors of the calls in the responses
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("rpc authentication failed")
+	case resp.StatusCode >= 500:
+		return nil, &retryableError{fmt.Errorf("rpc status %v: %s", resp.Status, bytes.TrimSpace(data))}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("rpc status %v: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var responses []rpcResponse
+	err = json.Unmarshal(data, &responses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rpc response: %v", err)
+	}
+	return responses, nil
+}
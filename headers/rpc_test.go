@@ -0,0 +1,174 @@
+package headers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/test"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// mockBitcoind serves the JSON-RPC calls RPCSource makes over a fixture chain.
+type mockBitcoind struct {
+	chain    []Header
+	user     string
+	password string
+
+	mu       sync.Mutex
+	requests int //http requests served
+	failures int //the next failures requests are answered with 503
+}
+
+func newMockBitcoind(t *testing.T, chain []Header) (*mockBitcoind, string) {
+	m := &mockBitcoind{chain: chain, user: "user", password: "password"}
+	server := httptest.NewServer(m)
+	t.Cleanup(server.Close)
+	return m, server.URL
+}
+
+func (m *mockBitcoind) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.requests++
+	fail := m.failures > 0
+	if fail {
+		m.failures--
+	}
+	m.mu.Unlock()
+
+	if user, password, ok := r.BasicAuth(); !ok || user != m.user || password != m.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if fail {
+		http.Error(w, "Work queue depth exceeded", http.StatusServiceUnavailable)
+		return
+	}
+
+	var requests []rpcRequest
+	err := json.NewDecoder(r.Body).Decode(&requests)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//answer in reverse order, clients must match responses by id
+	responses := make([]map[string]any, len(requests))
+	for i, request := range requests {
+		result, rpcErr := m.handle(request)
+		responses[len(requests)-1-i] = map[string]any{"id": request.Id, "result": result, "error": rpcErr}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+func (m *mockBitcoind) reset(failures int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = 0
+	m.failures = failures
+}
+
+func (m *mockBitcoind) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests
+}
+
+func (m *mockBitcoind) handle(request rpcRequest) (any, *RPCError) {
+	switch request.Method {
+	case "getblockcount":
+		return len(m.chain) - 1, nil
+	case "getblockhash":
+		height, ok := request.Params[0].(float64)
+		if !ok || height < 0 || int(height) >= len(m.chain) {
+			return nil, &RPCError{Code: -8, Message: "Block height out of range"}
+		}
+		return chainhash.DoubleHashH(m.chain[int(height)][:]).String(), nil
+	case "getblockheader":
+		if verbose, _ := request.Params[1].(bool); verbose {
+			return nil, &RPCError{Code: -8, Message: "verbose headers are not served"}
+		}
+		for _, header := range m.chain {
+			if chainhash.DoubleHashH(header[:]).String() == request.Params[0] {
+				return hex.EncodeToString(header[:]), nil
+			}
+		}
+		return nil, &RPCError{Code: -5, Message: "Block not found"}
+	default:
+		return nil, &RPCError{Code: -32601, Message: "Method not found"}
+	}
+}
+
+func TestRPCSource(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 10)
+	bitcoind, url := newMockBitcoind(t, chain)
+
+	source, err := NewRPCSource(RPCConfig{URL: url, User: "user", Password: "password", BatchSize: 4})
+	assert.NoError(err)
+
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(10), tip)
+
+	bitcoind.reset(0)
+	headers, err := source.Headers(ctx, 1, 10)
+	assert.NoError(err)
+	assert.Equal(chain[1:], headers)
+	//a getblockhash and a getblockheader batch for each of 3 batches
+	assert.Equal(6, bitcoind.requestCount())
+
+	_, err = source.Headers(ctx, 5, 7)
+	var rpcErr *RPCError
+	assert.True(errors.As(err, &rpcErr))
+	assert.Equal(-8, rpcErr.Code)
+}
+
+func TestRPCSource_Retries(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	chain := testChain(t, 3)
+	bitcoind, url := newMockBitcoind(t, chain)
+
+	source, err := NewRPCSource(RPCConfig{URL: url, User: "user", Password: "password", Retries: 2})
+	assert.NoError(err)
+
+	bitcoind.reset(2)
+	headers, err := source.Headers(ctx, 0, 4)
+	assert.NoError(err)
+	assert.Equal(chain, headers)
+
+	bitcoind.reset(3)
+	_, err = source.Headers(ctx, 0, 4)
+	assert.Error(err)
+}
+
+func TestRPCSource_Auth(t *testing.T) {
+	assert := test.NewAssert(t)
+	ctx := context.Background()
+
+	_, url := newMockBitcoind(t, testChain(t, 3))
+
+	source, err := NewRPCSource(RPCConfig{URL: url, User: "user", Password: "wrong", Retries: 2})
+	assert.NoError(err)
+	_, err = source.TipHeight(ctx)
+	assert.Error(err)
+
+	cookieFile := filepath.Join(t.TempDir(), ".cookie")
+	assert.NoError(os.WriteFile(cookieFile, []byte("user:password"), 0600))
+	source, err = NewRPCSource(RPCConfig{URL: url, CookieFile: cookieFile})
+	assert.NoError(err)
+	tip, err := source.TipHeight(ctx)
+	assert.NoError(err)
+	assert.Equal(uint32(3), tip)
+}
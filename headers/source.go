@@ -0,0 +1,46 @@
+package headers
+
+import (
+	"context"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+)
+
+// Header is a raw 80-byte block header.
+type Header = [circuits.BlockHeaderLen]byte
+
+// Source provides the headers of the best chain of a network by height.
+type Source interface {
+	// TipHeight returns the height of the best block known to the source.
+	TipHeight(ctx context.Context) (uint32, error)
+	// Headers returns count consecutive headers, the first one at height.
+	Headers(ctx context.Context, height uint32, count int) ([]Header, error)
+}
+
+// PrevHash returns the hash of the block header builds on.
+func PrevHash(header Header) chainhash.Hash {
+	return chainhash.Hash(header[circuits.BeginHashOffset : circuits.BeginHashOffset+circuits.HashLen])
+}
+
+// CheckLinkage checks that headers form a chain on top of the block with hash parent.
+func CheckLinkage(parent chainhash.Hash, headers []Header) error {
+	for i, header := range headers {
+		if PrevHash(header) != parent {
+			return fmt.Errorf("header %v builds on %v instead of %v", i, PrevHash(header), parent)
+		}
+		parent = chainhash.DoubleHashH(header[:])
+	}
+	return nil
+}
+
+// checkRange checks that count headers from height are below a tip at tipHeight.
+func checkRange(height uint32, count int, tipHeight uint32) error {
+	if count <= 0 {
+		return fmt.Errorf("invalid header count %v", count)
+	}
+	if uint64(height)+uint64(count)-1 > uint64(tipHeight) {
+		return fmt.Errorf("headers %v to %v beyond tip %v", height, uint64(height)+uint64(count)-1, tipHeight)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package headers
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"testing"
+)
+
+const regTestGenesis = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff7f2002000000"
+
+func genesisHeader(t *testing.T) Header {
+	header, err := hex.DecodeString(regTestGenesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Header(header)
+}
+
+// extend mines n regtest headers on top of parent, seed tells apart the headers of different
+// branches.
+func extend(parent Header, n int, seed uint32) []Header {
+	headers := make([]Header, n)
+	for i := range headers {
+		var header Header
+		binary.LittleEndian.PutUint32(header[0:], 0x20000000)
+		prevHash := chainhash.DoubleHashH(parent[:])
+		copy(header[circuits.BeginHashOffset:], prevHash[:])
+		binary.LittleEndian.PutUint32(header[circuits.MerkleRootOffset:], seed)
+		binary.LittleEndian.PutUint32(header[circuits.TimestampOffset:], binary.LittleEndian.Uint32(parent[circuits.TimestampOffset:])+600)
+		binary.LittleEndian.PutUint32(header[circuits.BitsOffset:], circuits.RegTest.PowLimitBits)
+		for nonce := uint32(0); ; nonce++ {
+			binary.LittleEndian.PutUint32(header[circuits.BitsOffset+circuits.BitsLen:], nonce)
+			if circuits.CheckProofOfWork(circuits.RegTest, header) == nil {
+				break
+			}
+		}
+		headers[i] = header
+		parent = header
+	}
+	return headers
+}
+
+// testChain returns the regtest genesis header followed by n headers.
+func testChain(t *testing.T, n int) []Header {
+	genesis := genesisHeader(t)
+	return append([]Header{genesis}, extend(genesis, n, 0)...)
+}
+
+func TestCheckLinkage(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	chain := testChain(t, 5)
+	assert.NoError(CheckLinkage(circuits.RegTest.GenesisHash, chain[1:]))
+	assert.Error(CheckLinkage(circuits.RegTest.GenesisHash, chain[2:]))
+
+	chain[3], chain[4] = chain[4], chain[3]
+	assert.Error(CheckLinkage(circuits.RegTest.GenesisHash, chain[1:]))
+}
@@ -0,0 +1,85 @@
+// Package testutil holds the fixtures the tests of several packages share.
+package testutil
+
+import (
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"testing"
+)
+
+// BeginHeight is the height of the block Headers build on.
+const BeginHeight = 7
+
+var (
+	// Headers are mainnet blocks 8 to 10, hex encoded.
+	Headers = []string{
+		"010000004494c8cf4154bdcc0720cd4a59d9c9b285e4b146d45f061d2b6c967100000000e3855ed886605b6d4a99d5fa2ef2e9b0b164e63df3c4136bebf2d0dac0f1f7a667c86649ffff001d1c4b5666",
+		"01000000c60ddef1b7618ca2348a46e868afc26e3efc68226c78aa47f8488c4000000000c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd37047fca6649ffff001d28404f53",
+		"010000000508085c47cc849eb80ea905cc7800a3be674ffc57263cf210c59d8d00000000112ba175a1e04b14ba9e7ea5f76ab640affeef5ec98173ac9799a852fa39add320cd6649ffff001d1e2de565",
+	}
+
+	// State is the mainnet chain state after block 7, the genesis state advanced by blocks 1 to 7.
+	State = circuits.NativeChainState{EpochBits: 0x1d00ffff, EpochStartTime: 1231006505, Bits: 0x1d00ffff, Timestamps: [circuits.MedianTimeSpan]uint32{
+		0xffffffff, 0, 0xffffffff, 1231006505, 1231469665, 1231469744,
+		1231470173, 1231470988, 1231471428, 1231471789, 1231472369,
+	}}
+)
+
+// BlockHeaders decodes the first n of Headers.
+func BlockHeaders(t *testing.T, n int) [][circuits.BlockHeaderLen]byte {
+	blockHeaders := make([][circuits.BlockHeaderLen]byte, n)
+	for i, h := range Headers[:n] {
+		header, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockHeaders[i] = [circuits.BlockHeaderLen]byte(header)
+	}
+	return blockHeaders
+}
+
+// FakeChainCircuit has the public layout of the recursive circuit and proves nothing about it. Like
+// the recursive circuit, it has a commitment.
+type FakeChainCircuit struct {
+	Public [circuits.NbPublicVariables]frontend.Variable `gnark:",public"`
+	Square frontend.Variable
+}
+
+func (c *FakeChainCircuit) Define(api frontend.API) error {
+	square := api.Mul(c.Public[0], c.Public[0])
+	api.AssertIsEqual(square, c.Square)
+	commitment, err := api.(frontend.Committer).Commit(square)
+	if err != nil {
+		return err
+	}
+	api.AssertIsDifferent(commitment, 0)
+	return nil
+}
+
+// NewFakeChainAssignment assigns FakeChainCircuit the public witness of a batch of the first two
+// Headers, from State at BeginHeight, with vkFp as their fingerprint.
+func NewFakeChainAssignment(t *testing.T, vkFp utils.FingerPrintBytes) *FakeChainCircuit {
+	batch, err := circuits.NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](circuits.MainNet, BlockHeaders(t, 2), BeginHeight, State, vkFp, circuits.ByteLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := frontend.NewWitness(batch, ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec := public.Vector().(fr.Vector)
+
+	assignment := &FakeChainCircuit{}
+	for i := range assignment.Public {
+		assignment.Public[i] = vec[i]
+	}
+	var square fr.Element
+	square.Square(&vec[0])
+	assignment.Square = square
+	return assignment
+}
@@ -0,0 +1,109 @@
+package prover
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"math/big"
+)
+
+// Chain holds what the assignments need to know about a range of consecutive headers.
+type Chain struct {
+	Network     *circuits.Network
+	Headers     [][circuits.BlockHeaderLen]byte
+	Hashes      [][circuits.HashLen]byte
+	BeginHeight uint32 //height of the block Headers[0] builds on
+	BeginState  circuits.NativeChainState
+
+	chainWorks  []*big.Int                  //chainWorks[i] is the work of Headers[0..i]
+	chainStates []circuits.NativeChainState //chainStates[i] is the state after Headers[i]
+}
+
+// NewChain validates the headers natively, so that a broken input fails before any proving.
+func NewChain(net *circuits.Network, headers [][circuits.BlockHeaderLen]byte, beginHeight uint32, beginState circuits.NativeChainState) (*Chain, error) {
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("no headers")
+	}
+
+	c := &Chain{
+		Network:     net,
+		Headers:     headers,
+		Hashes:      make([][circuits.HashLen]byte, len(headers)),
+		BeginHeight: beginHeight,
+		BeginState:  beginState,
+		chainWorks:  make([]*big.Int, len(headers)),
+		chainStates: make([]circuits.NativeChainState, len(headers)),
+	}
+
+	for i, header := range headers {
+		c.Hashes[i] = chainhash.DoubleHashH(header[:])
+		if i > 0 && [circuits.HashLen]byte(header[circuits.BeginHashOffset:circuits.BeginHashOffset+circuits.HashLen]) != c.Hashes[i-1] {
+			return nil, fmt.Errorf("header %v does not build on header %v", i, i-1)
+		}
+
+		err := circuits.CheckProofOfWork(net, header)
+		if err != nil {
+			return nil, fmt.Errorf("header %v: %v", i, err)
+		}
+
+		work, err := circuits.HeaderWork(header)
+		if err != nil {
+			return nil, err
+		}
+		c.chainWorks[i] = work
+		if i > 0 {
+			c.chainWorks[i].Add(c.chainWorks[i], c.chainWorks[i-1])
+		}
+
+		c.chainStates[i], err = c.State(i).Next(net, c.Height(i), header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ParentHash returns the hash of the block Headers[0] builds on.
+func (c *Chain) ParentHash() [circuits.HashLen]byte {
+	return [circuits.HashLen]byte(c.Headers[0][circuits.BeginHashOffset : circuits.BeginHashOffset+circuits.HashLen])
+}
+
+// Height returns the height of Headers[i].
+func (c *Chain) Height(i int) uint32 {
+	return c.BeginHeight + uint32(i) + 1
+}
+
+// Work returns the work of Headers[begin:end].
+func (c *Chain) Work(begin, end int) *big.Int {
+	work := new(big.Int).Set(c.chainWorks[end-1])
+	if begin > 0 {
+		work.Sub(work, c.chainWorks[begin-1])
+	}
+	return work
+}
+
+// State returns the state before Headers[i].
+func (c *Chain) State(i int) circuits.NativeChainState {
+	if i == 0 {
+		return c.BeginState
+	}
+	return c.chainStates[i-1]
+}
+
+// EndState returns the state after the last header.
+func (c *Chain) EndState() circuits.NativeChainState {
+	return c.chainStates[len(c.chainStates)-1]
+}
+
+// Leaves splits the headers into the ranges of leaf proofs of size headers each.
+func (c *Chain) Leaves(size int) ([][2]int, error) {
+	if len(c.Headers)%size != 0 {
+		return nil, fmt.Errorf("%v headers do not split into batches of %v", len(c.Headers), size)
+	}
+
+	ranges := make([][2]int, 0, len(c.Headers)/size)
+	for begin := 0; begin < len(c.Headers); begin += size {
+		ranges = append(ranges, [2]int{begin, begin + size})
+	}
+	return ranges, nil
+}
@@ -0,0 +1,60 @@
+package prover
+
+import (
+	"encoding/json"
+	"fmt"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"os"
+)
+
+// WriteRangeProof writes the proof, the public witness and the MMR peaks of rp to base.proof,
+// base.wtns and base.mmr. The peaks are what a later proof needs to extend rp.
+func WriteRangeProof(rp *RangeProof, base string) error {
+	err := operations.WriteProof(rp.Proof, base+".proof")
+	if err != nil {
+		return err
+	}
+
+	err = operations.WriteWitness(rp.Witness, base+".wtns")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rp.MMR)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(base+".mmr", data, 0644)
+}
+
+// ReadRangeProof reads a range proof written by WriteRangeProof, vk is the verifying key of the
+// circuit that produced it.
+func ReadRangeProof(vk native_plonk.VerifyingKey, base string) (*RangeProof, error) {
+	proof, err := operations.ReadProof(base + ".proof")
+	if err != nil {
+		return nil, err
+	}
+
+	wit, err := operations.ReadWitness(base + ".wtns")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(base + ".mmr")
+	if err != nil {
+		return nil, err
+	}
+	var mmr circuits.MMR
+	err = json.Unmarshal(data, &mmr)
+	if err != nil {
+		return nil, fmt.Errorf("%v.mmr: %v", base, err)
+	}
+
+	rp, err := NewRangeProof(vk, proof, wit, &mmr)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", base, err)
+	}
+	return rp, nil
+}
@@ -0,0 +1,147 @@
+package prover
+
+import (
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	cs_bn254 "github.com/consensys/gnark/constraint/bn254"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"io"
+	"os"
+)
+
+// Groth16Circuit holds the loaded artifacts of the Groth16 circuit wrapping recursive proofs.
+type Groth16Circuit struct {
+	Ccs constraint.ConstraintSystem
+	Pk  groth16.ProvingKey
+	Vk  groth16.VerifyingKey
+}
+
+// SetupGroth16 compiles the Groth16 circuit over proofs of the recursive circuit recursiveCcs, with
+// the vk fingerprint recursiveVkFp, and runs its setup. The toxic waste of the setup is known to
+// this process only, which makes it fit for testing: production keys come from a ceremony.
+func SetupGroth16(recursiveCcs constraint.ConstraintSystem, recursiveVkFp utils.FingerPrintBytes) (*Groth16Circuit, error) {
+	circuit := circuits.NewBlockHeaderGroth16Circuit[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](recursiveCcs, recursiveVkFp)
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		return nil, err
+	}
+	return &Groth16Circuit{Ccs: ccs, Pk: pk, Vk: vk}, nil
+}
+
+// Wrap proves rp, a recursive proof, with the Groth16 circuit and verifies the proof before
+// returning it. The public witness is that of rp.
+func (c *Groth16Circuit) Wrap(rp *RangeProof) (groth16.Proof, witness.Witness, error) {
+	assignment, err := circuits.NewBlockHeaderGroth16Assignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](rp.Vk, rp.Proof, rp.Witness)
+	if err != nil {
+		return nil, nil, err
+	}
+	wit, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof, err := groth16.Prove(c.Ccs, c.Pk, wit)
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := wit.Public()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = groth16.Verify(proof, c.Vk, public)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, public, nil
+}
+
+// WriteGroth16Circuit writes the ccs, pk and vk of c to ccsFile, pkFile and vkFile.
+func WriteGroth16Circuit(c *Groth16Circuit, ccsFile, pkFile, vkFile string) error {
+	err := writeTo(c.Ccs, ccsFile)
+	if err != nil {
+		return err
+	}
+	err = writeTo(c.Pk, pkFile)
+	if err != nil {
+		return err
+	}
+	return writeTo(c.Vk, vkFile)
+}
+
+// ReadGroth16Circuit reads the artifacts written by WriteGroth16Circuit.
+func ReadGroth16Circuit(ccsFile, pkFile, vkFile string) (*Groth16Circuit, error) {
+	var ccs cs_bn254.R1CS
+	err := readFrom(&ccs, ccsFile)
+	if err != nil {
+		return nil, err
+	}
+	pk := groth16.NewProvingKey(ecc.BN254)
+	err = readFrom(pk, pkFile)
+	if err != nil {
+		return nil, err
+	}
+	vk, err := ReadGroth16Vk(vkFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Groth16Circuit{Ccs: &ccs, Pk: pk, Vk: vk}, nil
+}
+
+func ReadGroth16Vk(fn string) (groth16.VerifyingKey, error) {
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	err := readFrom(vk, fn)
+	if err != nil {
+		return nil, err
+	}
+	return vk, nil
+}
+
+func WriteGroth16Proof(proof groth16.Proof, fn string) error {
+	return writeTo(proof, fn)
+}
+
+func ReadGroth16Proof(fn string) (groth16.Proof, error) {
+	proof := groth16.NewProof(ecc.BN254)
+	err := readFrom(proof, fn)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func writeTo(v io.WriterTo, fn string) error {
+	f, err := operations.OpenFileOnCreaterOverwrite(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = v.WriteTo(f)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func readFrom(v io.ReaderFrom, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = v.ReadFrom(f)
+	return err
+}
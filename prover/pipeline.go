@@ -0,0 +1,90 @@
+package prover
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"time"
+)
+
+// ProvePipelined proves the leaves of c and folds them one by one into prev, or into the first
+// leaf if prev is nil. The leaf proofs stream from the pool into the recursive stage, recursive
+// step i starts as soon as leaf i and step i-1 are done, so proving a long range takes about as
+// long as the slower of the two stages rather than both. Leaf and recursive proofs share the memory
+// budget of cfg.
+func (p *Prover) ProvePipelined(ctx context.Context, prev *RangeProof, c *Chain, cfg PoolConfig) (*RangeProof, error) {
+	leaves, err := c.Leaves(p.LeafSize())
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil && len(leaves) < 2 {
+		return nil, fmt.Errorf("a recursive proof needs at least two leaf proofs")
+	}
+	if p.Recursive == nil {
+		return nil, fmt.Errorf("no recursive circuit to merge with")
+	}
+	if cfg.ProofMemory == 0 {
+		cfg.ProofMemory = EstimateProofMemory(p.Leaf.Ccs)
+	}
+	if cfg.MergeMemory == 0 {
+		cfg.MergeMemory = EstimateProofMemory(p.Recursive.Ccs)
+	}
+	memory, err := newMemoryBudget(cfg.MemoryBudget, max(cfg.ProofMemory, cfg.MergeMemory))
+	if err != nil {
+		return nil, err
+	}
+
+	return pipeline(ctx, prev, len(leaves), cfg, memory,
+		func(i int) (*RangeProof, error) {
+			return p.ProveLeaf(c, leaves[i][0], leaves[i][1])
+		},
+		p.Merge,
+	)
+}
+
+// pipeline proves n leaves with prove on a pool and folds them in order into prev with merge as
+// they come out of the pool.
+func pipeline(ctx context.Context, prev *RangeProof, n int, cfg PoolConfig, memory *memoryBudget,
+	prove func(i int) (*RangeProof, error), merge func(first, second *RangeProof) (*RangeProof, error)) (*RangeProof, error) {
+	leaves := make(chan *RangeProof)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(leaves)
+		return streamPool(ctx, n, cfg, memory, prove, leaves)
+	})
+
+	acc := prev
+	g.Go(func() error {
+		for leaf := range leaves {
+			if acc == nil {
+				acc = leaf
+				continue
+			}
+
+			err := memory.acquire(ctx, cfg.MergeMemory)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			acc, err = merge(acc, leaf)
+			memory.release(cfg.MergeMemory)
+			if err != nil {
+				return err
+			}
+
+			if cfg.OnMerge != nil {
+				err = cfg.OnMerge(acc, time.Since(start))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
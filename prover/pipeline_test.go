@@ -0,0 +1,78 @@
+package prover
+
+import (
+	"context"
+	"fmt"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	var mu sync.Mutex
+	var lastLeafDone, firstMergeStart time.Time
+	prove := func(i int) (*RangeProof, error) {
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		lastLeafDone = time.Now()
+		return &RangeProof{Public: &circuits.PublicWitness{BeginHeight: 10 + uint32(i), Count: 1}}, nil
+	}
+	merge := func(first, second *RangeProof) (*RangeProof, error) {
+		mu.Lock()
+		if firstMergeStart.IsZero() {
+			firstMergeStart = time.Now()
+		}
+		mu.Unlock()
+		if second.Public.BeginHeight != first.Public.EndHeight() {
+			return nil, fmt.Errorf("range above %v does not follow the range up to %v", second.Public.BeginHeight, first.Public.EndHeight())
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &RangeProof{Public: &circuits.PublicWitness{BeginHeight: first.Public.BeginHeight, Count: first.Public.Count + second.Public.Count}}, nil
+	}
+
+	merges := 0
+	cfg := PoolConfig{Workers: 1, OnMerge: func(rp *RangeProof, took time.Duration) error {
+		merges++
+		return nil
+	}}
+	acc, err := pipeline(context.Background(), nil, 20, cfg, nil, prove, merge)
+	assert.NoError(err)
+	assert.Equal(uint32(10), acc.Public.BeginHeight)
+	assert.Equal(uint32(20), acc.Public.Count)
+	assert.Equal(19, merges)
+	//the recursive stage does not wait for all the leaves
+	assert.True(firstMergeStart.Before(lastLeafDone))
+
+	prev := &RangeProof{Public: &circuits.PublicWitness{BeginHeight: 0, Count: 10}}
+	acc, err = pipeline(context.Background(), prev, 5, PoolConfig{Workers: 3}, nil, prove, merge)
+	assert.NoError(err)
+	assert.Equal(uint32(0), acc.Public.BeginHeight)
+	assert.Equal(uint32(15), acc.Public.Count)
+
+	//a failing merge stops the leaves
+	prev = &RangeProof{Public: &circuits.PublicWitness{BeginHeight: 0, Count: 9}}
+	_, err = pipeline(context.Background(), prev, 5, PoolConfig{Workers: 1}, nil, prove, merge)
+	assert.Error(err)
+
+	//a failing leaf stops the merges
+	failing := func(i int) (*RangeProof, error) {
+		if i == 3 {
+			return nil, fmt.Errorf("proof %v failed", i)
+		}
+		return prove(i)
+	}
+	_, err = pipeline(context.Background(), nil, 10, PoolConfig{Workers: 2}, nil, failing, merge)
+	assert.Error(err)
+
+	//leaves and merges share the memory budget
+	memory, err := newMemoryBudget(100, 100)
+	assert.NoError(err)
+	acc, err = pipeline(context.Background(), nil, 10, PoolConfig{Workers: 4, ProofMemory: 60, MergeMemory: 100}, memory, prove, merge)
+	assert.NoError(err)
+	assert.Equal(uint32(10), acc.Public.Count)
+}
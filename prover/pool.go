@@ -0,0 +1,176 @@
+package prover
+
+import (
+	"context"
+	"fmt"
+	"github.com/consensys/gnark/constraint"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"math/bits"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// PoolConfig bounds the proofs a pool runs at once, by number and by memory.
+type PoolConfig struct {
+	Workers      int    //leaf proofs in flight at once, defaults to runtime.GOMAXPROCS
+	MemoryBudget uint64 //bytes the proofs in flight may use together, 0 for no limit
+	ProofMemory  uint64 //bytes a leaf proof uses, defaults to EstimateProofMemory of the leaf circuit
+	MergeMemory  uint64 //bytes a recursive proof uses, defaults to EstimateProofMemory of the recursive circuit
+
+	// OnProof, if set, is called once a leaf proof is done with its index and how long it took.
+	// Calls are serialized but come in completion order, an error stops the pool.
+	OnProof func(index int, rp *RangeProof, took time.Duration) error
+	// OnMerge, if set, is called once a recursive proof is done with how long it took, an error
+	// stops the pipeline.
+	OnMerge func(rp *RangeProof, took time.Duration) error
+}
+
+// bytes a plonk prover keeps per row of the evaluation domain, a rough upper bound of the
+// polynomials it holds over the domain and the 4 times larger quotient domain
+const proofMemoryPerRow = 1024
+
+// EstimateProofMemory estimates the memory a plonk proof of ccs takes.
+func EstimateProofMemory(ccs constraint.ConstraintSystem) uint64 {
+	rows := uint64(ccs.GetNbConstraints() + ccs.GetNbPublicVariables())
+	domain := uint64(1) << bits.Len64(rows-1)
+	return domain * proofMemoryPerRow
+}
+
+// ProveLeavesParallel proves the leaves of c on a pool of goroutines sharing the loaded leaf
+// circuit. The proofs are returned in chain order, whatever order they finish in.
+func (p *Prover) ProveLeavesParallel(ctx context.Context, c *Chain, cfg PoolConfig) ([]*RangeProof, error) {
+	leaves, err := c.Leaves(p.LeafSize())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ProofMemory == 0 {
+		cfg.ProofMemory = EstimateProofMemory(p.Leaf.Ccs)
+	}
+
+	return runPool(ctx, len(leaves), cfg, func(i int) (*RangeProof, error) {
+		return p.ProveLeaf(c, leaves[i][0], leaves[i][1])
+	})
+}
+
+// runPool runs prove for the indices [0, n) within the bounds of cfg, and returns the proofs by
+// index. After the first error no further proofs are started.
+func runPool(ctx context.Context, n int, cfg PoolConfig, prove func(i int) (*RangeProof, error)) ([]*RangeProof, error) {
+	memory, err := newMemoryBudget(cfg.MemoryBudget, cfg.ProofMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *RangeProof, n)
+	err = streamPool(ctx, n, cfg, memory, prove, out)
+	close(out)
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*RangeProof, 0, n)
+	for rp := range out {
+		proofs = append(proofs, rp)
+	}
+	return proofs, nil
+}
+
+// streamPool runs prove for the indices [0, n) within the bounds of cfg and sends the proofs on out
+// in index order, each as soon as it and the proofs before it are done. After the first error no
+// further proofs are started.
+func streamPool(ctx context.Context, n int, cfg PoolConfig, memory *memoryBudget, prove func(i int) (*RangeProof, error), out chan<- *RangeProof) error {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]chan *RangeProof, n)
+	for i := range results {
+		results[i] = make(chan *RangeProof, 1)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	//forward the proofs in order
+	g.Go(func() error {
+		for _, result := range results {
+			var rp *RangeProof
+			select {
+			case rp = <-result:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case out <- rp:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		var mu sync.Mutex //serializes OnProof
+		w, ctx := errgroup.WithContext(ctx)
+		w.SetLimit(workers)
+		for i, result := range results {
+			//check before w.Go, which blocks while all workers are busy
+			if ctx.Err() != nil {
+				break
+			}
+			w.Go(func() error {
+				err := memory.acquire(ctx, cfg.ProofMemory)
+				if err != nil {
+					return err
+				}
+				defer memory.release(cfg.ProofMemory)
+
+				start := time.Now()
+				rp, err := prove(i)
+				if err != nil {
+					return err
+				}
+				result <- rp
+
+				if cfg.OnProof == nil {
+					return nil
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				return cfg.OnProof(i, rp, time.Since(start))
+			})
+		}
+		return w.Wait()
+	})
+	return g.Wait()
+}
+
+// memoryBudget bounds the memory of the proofs in flight, a nil budget is unbounded.
+type memoryBudget struct {
+	sem *semaphore.Weighted
+}
+
+// newMemoryBudget returns a budget of total bytes, or nil if total is 0. It fails if the largest
+// proof to run does not fit, as acquiring it would block forever.
+func newMemoryBudget(total, largest uint64) (*memoryBudget, error) {
+	if total == 0 {
+		return nil, nil
+	}
+	if largest > total {
+		return nil, fmt.Errorf("memory budget of %v bytes does not fit a proof of %v bytes", total, largest)
+	}
+	return &memoryBudget{sem: semaphore.NewWeighted(int64(total))}, nil
+}
+
+func (m *memoryBudget) acquire(ctx context.Context, n uint64) error {
+	if m == nil {
+		return ctx.Err()
+	}
+	return m.sem.Acquire(ctx, int64(n))
+}
+
+func (m *memoryBudget) release(n uint64) {
+	if m != nil {
+		m.sem.Release(int64(n))
+	}
+}
@@ -0,0 +1,94 @@
+package prover
+
+import (
+	"context"
+	"fmt"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProver stands in for the leaf circuit, recording how many proofs are in flight at most.
+type fakeProver struct {
+	inFlight, maxInFlight, started atomic.Int32
+	failAt                         int
+}
+
+func (f *fakeProver) prove(i int) (*RangeProof, error) {
+	f.started.Add(1)
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		m := f.maxInFlight.Load()
+		if n <= m || f.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	//later proofs finish first
+	time.Sleep(time.Duration(10-i%10) * time.Millisecond)
+	if i == f.failAt {
+		return nil, fmt.Errorf("proof %v failed", i)
+	}
+	return &RangeProof{Public: &circuits.PublicWitness{BeginHeight: uint32(i)}}, nil
+}
+
+func TestRunPool(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	f := &fakeProver{failAt: -1}
+	var mu sync.Mutex
+	reported := make(map[int]bool)
+	proofs, err := runPool(context.Background(), 20, PoolConfig{
+		Workers: 4,
+		OnProof: func(index int, rp *RangeProof, took time.Duration) error {
+			mu.Lock()
+			defer mu.Unlock()
+			reported[index] = true
+			assert.True(took > 0)
+			return nil
+		},
+	}, f.prove)
+	assert.NoError(err)
+	assert.Equal(20, len(proofs))
+	for i, rp := range proofs {
+		assert.Equal(uint32(i), rp.Public.BeginHeight)
+	}
+	assert.Equal(20, len(reported))
+	assert.True(f.maxInFlight.Load() <= 4, "%v proofs in flight", f.maxInFlight.Load())
+
+	//the memory budget binds before the number of workers
+	f = &fakeProver{failAt: -1}
+	_, err = runPool(context.Background(), 20, PoolConfig{Workers: 4, MemoryBudget: 250, ProofMemory: 100}, f.prove)
+	assert.NoError(err)
+	assert.True(f.maxInFlight.Load() <= 2, "%v proofs in flight", f.maxInFlight.Load())
+
+	_, err = runPool(context.Background(), 20, PoolConfig{Workers: 4, MemoryBudget: 50, ProofMemory: 100}, f.prove)
+	assert.Error(err)
+}
+
+func TestRunPool_Error(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	f := &fakeProver{failAt: 3}
+	_, err := runPool(context.Background(), 100, PoolConfig{Workers: 2}, f.prove)
+	assert.Error(err)
+	assert.True(f.started.Load() < 100, "%v proofs started", f.started.Load())
+
+	f = &fakeProver{failAt: -1}
+	_, err = runPool(context.Background(), 10, PoolConfig{
+		Workers: 2,
+		OnProof: func(index int, rp *RangeProof, took time.Duration) error {
+			return fmt.Errorf("cannot write proof %v", index)
+		},
+	}, f.prove)
+	assert.Error(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = runPool(ctx, 10, PoolConfig{Workers: 2}, f.prove)
+	assert.Error(err)
+}
@@ -0,0 +1,282 @@
+package prover
+
+import (
+	"context"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"math/big"
+)
+
+// Circuit holds the loaded artifacts of a circuit.
+type Circuit struct {
+	Ccs  constraint.ConstraintSystem
+	Pk   native_plonk.ProvingKey
+	Vk   native_plonk.VerifyingKey
+	VkFp utils.FingerPrintBytes
+}
+
+func NewCircuit(ccs constraint.ConstraintSystem, pk native_plonk.ProvingKey, vk native_plonk.VerifyingKey) (*Circuit, error) {
+	vkFp, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	if err != nil {
+		return nil, err
+	}
+	return &Circuit{Ccs: ccs, Pk: pk, Vk: vk, VkFp: vkFp}, nil
+}
+
+// Prove proves assignment and verifies the proof before returning it.
+func (c *Circuit) Prove(assignment frontend.Circuit) (native_plonk.Proof, witness.Witness, error) {
+	return c.prove(assignment, false)
+}
+
+// ProveSolidity proves assignment for the Solidity verifier exported from Vk. The recursive
+// circuit cannot merge such a proof, its transcript is hashed with SHA-256 as the contract does.
+func (c *Circuit) ProveSolidity(assignment frontend.Circuit) (native_plonk.Proof, witness.Witness, error) {
+	return c.prove(assignment, true)
+}
+
+func (c *Circuit) prove(assignment frontend.Circuit, solidity bool) (native_plonk.Proof, witness.Witness, error) {
+	proof, wit, err := operations.PlonkProve(c.Ccs, c.Pk, assignment, solidity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = operations.PlonkVerify(c.Vk, proof, wit, solidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	return proof, wit, nil
+}
+
+// RangeProof is a unit, batch or recursive proof of a range of headers, with the MMR over their
+// hashes the proof commits to.
+type RangeProof struct {
+	Vk      native_plonk.VerifyingKey
+	Proof   native_plonk.Proof
+	Witness witness.Witness
+	Public  *circuits.PublicWitness
+	MMR     *circuits.MMR
+}
+
+func NewRangeProof(vk native_plonk.VerifyingKey, proof native_plonk.Proof, wit witness.Witness, mmr *circuits.MMR) (*RangeProof, error) {
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return nil, err
+	}
+	root := mmr.Root()
+	if mmr.Count() != public.Count || !root.Equal(&public.MMRRoot) {
+		return nil, fmt.Errorf("mmr of %v leaves does not match the proof of %v headers", mmr.Count(), public.Count)
+	}
+	return &RangeProof{Vk: vk, Proof: proof, Witness: wit, Public: public, MMR: mmr}, nil
+}
+
+// Prover proves ranges of headers of a network. Leaves of BatchSize headers are proven by the
+// batch circuit, single headers by the unit circuit if BatchSize is 0, and ranges are merged by
+// the recursive circuit over those leaves. BatchSize must pass CheckBatchSize.
+type Prover struct {
+	Network   *circuits.Network
+	Leaf      *Circuit
+	BatchSize int
+	Recursive *Circuit //only needed for merging
+}
+
+// CheckBatchSize checks that leaves of n headers, or of single headers if n is 0, can be merged
+// by the recursive circuit. MergeMMR only lines the leaves of a range up with the peaks of the range
+// before it if the ranges are made of leaves a power of two in size.
+func CheckBatchSize(n int) error {
+	if n < 0 || n&(n-1) != 0 {
+		return fmt.Errorf("batch of %v headers, the batch size must be a power of two", n)
+	}
+	return nil
+}
+
+// LeafSize returns the number of headers proven by a leaf proof.
+func (p *Prover) LeafSize() int {
+	if p.BatchSize == 0 {
+		return 1
+	}
+	return p.BatchSize
+}
+
+// ProveLeaf proves c.Headers[begin:end], a range of LeafSize headers.
+func (p *Prover) ProveLeaf(c *Chain, begin, end int) (*RangeProof, error) {
+	err := CheckBatchSize(p.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if end-begin != p.LeafSize() {
+		return nil, fmt.Errorf("leaf of %v headers, expected %v", end-begin, p.LeafSize())
+	}
+	beginHeight := c.BeginHeight + uint32(begin)
+	//the leaf circuit was set up in one of the layouts
+	layout, err := circuits.LayoutOf(p.Leaf.Ccs.GetNbPublicVariables())
+	if err != nil {
+		return nil, err
+	}
+
+	var assignment frontend.Circuit
+	if p.BatchSize == 0 {
+		assignment, err = circuits.NewBlockHeaderUnitAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](p.Network, c.Hashes[begin], c.Headers[begin], beginHeight, c.State(begin), p.Leaf.VkFp, layout)
+	} else {
+		assignment, err = circuits.NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](p.Network, c.Headers[begin:end], beginHeight, c.State(begin), p.Leaf.VkFp, layout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	proof, wit, err := p.Leaf.Prove(assignment)
+	if err != nil {
+		return nil, err
+	}
+	return NewRangeProof(p.Leaf.Vk, proof, wit, circuits.NewMMR(c.Hashes[begin:end]))
+}
+
+// ProveLeaves proves every leaf of c one after the other.
+func (p *Prover) ProveLeaves(c *Chain) ([]*RangeProof, error) {
+	leaves, err := c.Leaves(p.LeafSize())
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*RangeProof, len(leaves))
+	for i, leaf := range leaves {
+		proofs[i], err = p.ProveLeaf(c, leaf[0], leaf[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proofs, nil
+}
+
+// Merge proves the range of first followed by the range of second.
+func (p *Prover) Merge(first, second *RangeProof) (*RangeProof, error) {
+	return p.merge(first, second, false)
+}
+
+// MergeSolidity merges like Merge into a proof for the Solidity verifier of the recursive circuit,
+// which cannot be merged any further.
+func (p *Prover) MergeSolidity(first, second *RangeProof) (*RangeProof, error) {
+	return p.merge(first, second, true)
+}
+
+func (p *Prover) merge(first, second *RangeProof, solidity bool) (*RangeProof, error) {
+	if p.Recursive == nil {
+		return nil, fmt.Errorf("no recursive circuit to merge with")
+	}
+	f, s := first.Public, second.Public
+	if s.BeginHash != f.EndHash || s.BeginHeight != f.EndHeight() {
+		return nil, fmt.Errorf("range above %v does not follow the range up to %v", s.BeginHeight, f.EndHeight())
+	}
+
+	assignment, err := circuits.NewBlockHeaderRecursiveAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](
+		first.Vk, second.Vk,
+		first.Proof, second.Proof,
+		first.Witness, second.Witness,
+		utils.FingerPrintFromBytes[sw_bn254.ScalarField](p.Recursive.VkFp),
+		f.BeginHash,
+		f.EndHash,
+		s.EndHash,
+		new(big.Int).Add(f.ChainWork, s.ChainWork),
+		f.BeginHeight,
+		f.Count+s.Count,
+		f.BeginState,
+		s.EndState,
+		first.MMR, second.MMR,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	proof, wit, err := p.Recursive.prove(assignment, solidity)
+	if err != nil {
+		return nil, err
+	}
+
+	mmr, err := first.MMR.Merge(second.MMR)
+	if err != nil {
+		return nil, err
+	}
+	return NewRangeProof(p.Recursive.Vk, proof, wit, mmr)
+}
+
+// Commit proves with c, the commitment circuit over the recursive circuit, the commitment with h of
+// the public variables of rp. With solidity the proof is made for the Solidity verifier of c.Vk.
+func Commit(c *Circuit, h circuits.CommitmentHash, rp *RangeProof, solidity bool) (native_plonk.Proof, witness.Witness, error) {
+	assignment, err := circuits.NewBlockHeaderCommitmentAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](rp.Vk, rp.Proof, rp.Witness, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.prove(assignment, solidity)
+}
+
+// Fold merges proofs of consecutive ranges one by one into a single recursive proof, keeping only
+// the latest recursive proof.
+func (p *Prover) Fold(proofs []*RangeProof) (*RangeProof, error) {
+	if len(proofs) == 0 {
+		return nil, fmt.Errorf("no proofs to fold")
+	}
+
+	acc := proofs[0]
+	for _, proof := range proofs[1:] {
+		var err error
+		acc, err = p.Merge(acc, proof)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// FoldTree merges proofs of consecutive ranges pairwise, level by level, so the recursion depth is
+// log2 of the number of proofs instead of linear in it. Proofs of one level are independent and
+// may be proven in parallel.
+func (p *Prover) FoldTree(proofs []*RangeProof) (*RangeProof, error) {
+	if len(proofs) == 0 {
+		return nil, fmt.Errorf("no proofs to fold")
+	}
+
+	level := proofs
+	for len(level) > 1 {
+		next := make([]*RangeProof, 0, (len(level)+1)/2)
+		for i := 0; i+1 < len(level); i += 2 {
+			merged, err := p.Merge(level[i], level[i+1])
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, merged)
+		}
+
+		//an odd proof out is carried up to the next level
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// Extend proves headers, which must build on the last header proven by prev, and folds them into
+// prev. Only the new leaves are proven, so a proof of the chain tip can be kept up to date block by
+// block.
+func (p *Prover) Extend(ctx context.Context, prev *RangeProof, headers [][circuits.BlockHeaderLen]byte, cfg PoolConfig) (*RangeProof, error) {
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("no headers to extend with")
+	}
+
+	c, err := NewChain(p.Network, headers, prev.Public.EndHeight(), prev.Public.EndState)
+	if err != nil {
+		return nil, err
+	}
+	if c.ParentHash() != prev.Public.EndHash {
+		return nil, fmt.Errorf("headers build on %v instead of the last proven block %v",
+			chainhash.Hash(c.ParentHash()), chainhash.Hash(prev.Public.EndHash))
+	}
+	return p.ProvePipelined(ctx, prev, c, cfg)
+}
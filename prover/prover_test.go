@@ -0,0 +1,73 @@
+package prover
+
+import (
+	"context"
+	"github.com/consensys/gnark/test"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/internal/testutil"
+	"testing"
+)
+
+func TestNewChain(t *testing.T) {
+	assert := test.NewAssert(t)
+	blockHeaders := testutil.BlockHeaders(t, 3)
+
+	c, err := NewChain(circuits.MainNet, blockHeaders, testutil.BeginHeight, testutil.State)
+	assert.NoError(err)
+	assert.Equal(uint32(testutil.BeginHeight+1), c.Height(0))
+	assert.Equal([circuits.HashLen]byte(blockHeaders[0][circuits.BeginHashOffset:circuits.BeginHashOffset+circuits.HashLen]), c.ParentHash())
+	assert.Equal(testutil.State, c.State(0))
+
+	work, err := circuits.HeaderWork(blockHeaders[1])
+	assert.NoError(err)
+	assert.Equal(0, work.Cmp(c.Work(1, 2)))
+
+	leaves, err := c.Leaves(1)
+	assert.NoError(err)
+	assert.Equal([][2]int{{0, 1}, {1, 2}, {2, 3}}, leaves)
+	_, err = c.Leaves(2)
+	assert.Error(err)
+
+	_, err = NewChain(circuits.MainNet, [][circuits.BlockHeaderLen]byte{blockHeaders[0], blockHeaders[2]}, testutil.BeginHeight, testutil.State)
+	assert.Error(err)
+	_, err = NewChain(circuits.MainNet, nil, testutil.BeginHeight, testutil.State)
+	assert.Error(err)
+}
+
+func TestCheckBatchSize(t *testing.T) {
+	assert := test.NewAssert(t)
+
+	for _, n := range []int{0, 1, 2, 4, 64} {
+		assert.NoError(CheckBatchSize(n), n)
+	}
+	for _, n := range []int{-1, 3, 6, 100} {
+		assert.Error(CheckBatchSize(n), n)
+	}
+
+	//a prover with a batch size whose ranges can not be merged proves no leaf
+	c, err := NewChain(circuits.MainNet, testutil.BlockHeaders(t, 3), testutil.BeginHeight, testutil.State)
+	assert.NoError(err)
+	p := &Prover{Network: circuits.MainNet, Leaf: &Circuit{}, BatchSize: 3}
+	_, err = p.ProveLeaf(c, 0, 3)
+	assert.Error(err)
+}
+
+func TestProver_Extend(t *testing.T) {
+	assert := test.NewAssert(t)
+	blockHeaders := testutil.BlockHeaders(t, 3)
+
+	c, err := NewChain(circuits.MainNet, blockHeaders[:1], testutil.BeginHeight, testutil.State)
+	assert.NoError(err)
+	p := &Prover{Network: circuits.MainNet, Leaf: &Circuit{}, Recursive: &Circuit{}}
+
+	//headers that do not build on the proven range are rejected before any proving
+	prev := &RangeProof{Public: &circuits.PublicWitness{EndHash: c.Hashes[0], BeginHeight: testutil.BeginHeight, Count: 1, EndState: c.EndState()}}
+	_, err = p.Extend(context.Background(), prev, blockHeaders[2:], PoolConfig{})
+	assert.Error(err)
+	_, err = p.Extend(context.Background(), prev, nil, PoolConfig{})
+	assert.Error(err)
+
+	next := &RangeProof{Public: &circuits.PublicWitness{BeginHash: c.Hashes[0], BeginHeight: testutil.BeginHeight + 2, Count: 1}}
+	_, err = p.Merge(prev, next)
+	assert.Error(err)
+}
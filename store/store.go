@@ -0,0 +1,256 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Key addresses a proof by the range it proves and the fingerprint of the circuit that proved it.
+type Key struct {
+	BeginHash [circuits.HashLen]byte //hash of the block the range builds on
+	EndHash   [circuits.HashLen]byte //hash of the last block of the range
+	VkFp      string                 //hex encoded vk fingerprint
+}
+
+func KeyOf(public *circuits.PublicWitness) Key {
+	return Key{BeginHash: public.BeginHash, EndHash: public.EndHash, VkFp: hex.EncodeToString(public.VkFp)}
+}
+
+// Entry describes a stored proof.
+type Entry struct {
+	Key
+	BeginHeight uint32
+	EndHeight   uint32
+}
+
+// entryJson is the form of an Entry in its index file, hashes are in display order.
+type entryJson struct {
+	BeginHash   string
+	EndHash     string
+	VkFp        string
+	BeginHeight uint32
+	EndHeight   uint32
+}
+
+const entryExt = ".json"
+
+// Store keeps proofs in a directory, one subdirectory per circuit fingerprint holding the proof,
+// witness and MMR files of every range by the hashes of its ends. The index file of a proof is
+// written last, a proof is only listed once all its files are in place, and replacing a proof
+// removes its index file first, so a write that fails or is killed half way leaves no entry with
+// files of different proofs behind.
+type Store struct {
+	dir string
+}
+
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// base returns the path, without extension, of the files of key.
+func (s *Store) base(key Key) string {
+	name := chainhash.Hash(key.BeginHash).String() + "_" + chainhash.Hash(key.EndHash).String()
+	return filepath.Join(s.dir, key.VkFp, name)
+}
+
+// Put stores rp, replacing any proof of the same key.
+func (s *Store) Put(rp *prover.RangeProof) (Entry, error) {
+	entry := Entry{Key: KeyOf(rp.Public), BeginHeight: rp.Public.BeginHeight, EndHeight: rp.Public.EndHeight()}
+	base := s.base(entry.Key)
+	err := os.MkdirAll(filepath.Dir(base), 0755)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	//write under a temporary name next to the final files, then move them in place
+	tmp, err := os.CreateTemp(filepath.Dir(base), ".tmp-*")
+	if err != nil {
+		return Entry{}, err
+	}
+	tmpBase := tmp.Name()
+	_ = tmp.Close()
+	defer func() {
+		for _, ext := range []string{"", ".proof", ".wtns", ".mmr", entryExt} {
+			_ = os.Remove(tmpBase + ext)
+		}
+	}()
+
+	err = prover.WriteRangeProof(rp, tmpBase)
+	if err != nil {
+		return Entry{}, err
+	}
+	data, err := json.Marshal(entryJson{
+		BeginHash:   chainhash.Hash(entry.BeginHash).String(),
+		EndHash:     chainhash.Hash(entry.EndHash).String(),
+		VkFp:        entry.VkFp,
+		BeginHeight: entry.BeginHeight,
+		EndHeight:   entry.EndHeight,
+	})
+	if err != nil {
+		return Entry{}, err
+	}
+	err = os.WriteFile(tmpBase+entryExt, data, 0644)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	//hide the entry being replaced while its files are, the index file goes last and makes the
+	//entry visible again
+	err = os.Remove(base + entryExt)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Entry{}, err
+	}
+	for _, ext := range []string{".proof", ".wtns", ".mmr", entryExt} {
+		err = os.Rename(tmpBase+ext, base+ext)
+		if err != nil {
+			return Entry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// Get reads the proof of key, vk is the verifying key of the circuit of key.
+func (s *Store) Get(key Key, vk native_plonk.VerifyingKey) (*prover.RangeProof, error) {
+	base := s.base(key)
+	_, err := os.Stat(base + entryExt)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := prover.ReadRangeProof(vk, base)
+	if err != nil {
+		return nil, err
+	}
+	if KeyOf(rp.Public) != key {
+		return nil, fmt.Errorf("%v: proof does not match its name", base)
+	}
+	return rp, nil
+}
+
+// Has tells whether a proof of key is stored.
+func (s *Store) Has(key Key) bool {
+	_, err := os.Stat(s.base(key) + entryExt)
+	return err == nil
+}
+
+// List returns the stored proofs of the given fingerprints, or of all if none are given, ordered
+// by fingerprint, begin height and end height.
+func (s *Store) List(vkFps ...utils.FingerPrintBytes) ([]Entry, error) {
+	var dirs []string
+	if len(vkFps) == 0 {
+		files, err := os.ReadDir(s.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				dirs = append(dirs, f.Name())
+			}
+		}
+	} else {
+		for _, vkFp := range vkFps {
+			dirs = append(dirs, hex.EncodeToString(vkFp))
+		}
+	}
+
+	var entries []Entry
+	for _, dir := range dirs {
+		files, err := os.ReadDir(filepath.Join(s.dir, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), ".") || filepath.Ext(f.Name()) != entryExt {
+				continue
+			}
+			entry, err := readEntry(filepath.Join(s.dir, dir, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := strings.Compare(a.VkFp, b.VkFp); c != 0 {
+			return c
+		}
+		if a.BeginHeight != b.BeginHeight {
+			return int(a.BeginHeight) - int(b.BeginHeight)
+		}
+		return int(a.EndHeight) - int(b.EndHeight)
+	})
+	return entries, nil
+}
+
+// Best returns the stored proof of the given fingerprints covering the most of a chain: it starts
+// at beginHash and ends at the latest of ends, the hashes of the chain in order. It returns false
+// if no stored proof starts at beginHash and ends in the chain.
+func (s *Store) Best(beginHash [circuits.HashLen]byte, ends [][circuits.HashLen]byte, vkFps ...utils.FingerPrintBytes) (Entry, bool, error) {
+	entries, err := s.List(vkFps...)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	endIndex := make(map[[circuits.HashLen]byte]int, len(ends))
+	for i, end := range ends {
+		endIndex[end] = i
+	}
+
+	best, bestIndex := Entry{}, -1
+	for _, entry := range entries {
+		if entry.BeginHash != beginHash {
+			continue
+		}
+		i, ok := endIndex[entry.EndHash]
+		if ok && i > bestIndex {
+			best, bestIndex = entry, i
+		}
+	}
+	return best, bestIndex >= 0, nil
+}
+
+func readEntry(fn string) (Entry, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return Entry{}, err
+	}
+	var e entryJson
+	err = json.Unmarshal(data, &e)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%v: %v", fn, err)
+	}
+
+	beginHash, err := chainhash.NewHashFromStr(e.BeginHash)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%v: %v", fn, err)
+	}
+	endHash, err := chainhash.NewHashFromStr(e.EndHash)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%v: %v", fn, err)
+	}
+	return Entry{
+		Key:         Key{BeginHash: *beginHash, EndHash: *endHash, VkFp: e.VkFp},
+		BeginHeight: e.BeginHeight,
+		EndHeight:   e.EndHeight,
+	}, nil
+}
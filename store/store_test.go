@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/hex"
+	"github.com/consensys/gnark-crypto/ecc"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/internal/testutil"
+	"github.com/readygo67/BlockHeaderProver/prover"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type dummyCircuit struct {
+	X frontend.Variable `gnark:",public"`
+}
+
+func (c *dummyCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), 4)
+	return nil
+}
+
+// testProver returns a proof of a dummy circuit standing in for the proofs of the ranges, the store
+// does not verify what it keeps, and a function returning range proofs of the test headers.
+func testProver(t *testing.T) func(begin, end int, vkFp byte) *prover.RangeProof {
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &dummyCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, _, err := native_plonk.Setup(ccs, srs, lsrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wit, err := frontend.NewWitness(&dummyCircuit{X: 2}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := native_plonk.Prove(ccs, pk, wit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := prover.NewChain(circuits.MainNet, testutil.BlockHeaders(t, 3), testutil.BeginHeight, testutil.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func(begin, end int, vkFp byte) *prover.RangeProof {
+		fp := make([]byte, 32)
+		fp[31] = vkFp
+		assignment, err := circuits.NewBlockHeaderBatchAssignment[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](circuits.MainNet, c.Headers[begin:end], c.BeginHeight+uint32(begin), c.State(begin), fp, circuits.ByteLayout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, err := frontend.NewWitness(assignment, ecc.BN254.ScalarField(), frontend.PublicOnly())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rp, err := prover.NewRangeProof(nil, proof, public, circuits.NewMMR(c.Hashes[begin:end]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rp
+	}
+}
+
+func TestStore(t *testing.T) {
+	assert := test.NewAssert(t)
+	rangeProof := testProver(t)
+
+	s, err := Open(filepath.Join(t.TempDir(), "store"))
+	assert.NoError(err)
+
+	unit := rangeProof(0, 1, 1)
+	entry, err := s.Put(unit)
+	assert.NoError(err)
+	assert.Equal(uint32(testutil.BeginHeight), entry.BeginHeight)
+	assert.Equal(uint32(testutil.BeginHeight+1), entry.EndHeight)
+	assert.True(s.Has(entry.Key))
+
+	rp, err := s.Get(entry.Key, nil)
+	assert.NoError(err)
+	assert.Equal(unit.Public, rp.Public)
+	assert.Equal(unit.MMR.Root(), rp.MMR.Root())
+
+	_, err = s.Put(rangeProof(1, 2, 1))
+	assert.NoError(err)
+	_, err = s.Put(rangeProof(0, 2, 2))
+	assert.NoError(err)
+	_, err = s.Put(rangeProof(0, 3, 3))
+	assert.NoError(err)
+	//writing again replaces the entry
+	_, err = s.Put(rangeProof(0, 2, 2))
+	assert.NoError(err)
+
+	entries, err := s.List()
+	assert.NoError(err)
+	assert.Equal(4, len(entries))
+	for i, expected := range [][2]uint32{{0, 1}, {1, 2}, {0, 2}, {0, 3}} {
+		assert.Equal(testutil.BeginHeight+expected[0], entries[i].BeginHeight)
+		assert.Equal(testutil.BeginHeight+expected[1], entries[i].EndHeight)
+	}
+
+	fp := func(b byte) []byte {
+		fp := make([]byte, 32)
+		fp[31] = b
+		return fp
+	}
+	entries, err = s.List(fp(1), fp(9))
+	assert.NoError(err)
+	assert.Equal(2, len(entries))
+
+	//the best covering proof for the first two headers among the unit and recursive circuits
+	hashes := [][circuits.HashLen]byte{unit.Public.EndHash, rangeProof(1, 2, 1).Public.EndHash}
+	best, ok, err := s.Best(unit.Public.BeginHash, hashes, fp(1), fp(2))
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(uint32(testutil.BeginHeight+2), best.EndHeight)
+	assert.Equal(hex.EncodeToString(fp(2)), best.VkFp)
+
+	best, ok, err = s.Best(unit.Public.BeginHash, hashes[:1], fp(1), fp(2))
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(uint32(testutil.BeginHeight+1), best.EndHeight)
+
+	best, ok, err = s.Best(unit.Public.EndHash, hashes, fp(1), fp(2))
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(uint32(testutil.BeginHeight+1), best.BeginHeight)
+
+	_, ok, err = s.Best(unit.Public.BeginHash, hashes, fp(3))
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestStore_Partial(t *testing.T) {
+	assert := test.NewAssert(t)
+	rangeProof := testProver(t)
+
+	s, err := Open(t.TempDir())
+	assert.NoError(err)
+
+	entry, err := s.Put(rangeProof(0, 1, 1))
+	assert.NoError(err)
+
+	//a proof whose index file is missing, as left by an interrupted write, is not listed
+	base := s.base(entry.Key)
+	assert.NoError(os.Remove(base + entryExt))
+	assert.False(s.Has(entry.Key))
+	_, err = s.Get(entry.Key, nil)
+	assert.Error(err)
+
+	entries, err := s.List()
+	assert.NoError(err)
+	assert.Equal(0, len(entries))
+
+	//a replacement failing half way hides the entry instead of mixing the files of both proofs
+	entry, err = s.Put(rangeProof(0, 1, 1))
+	assert.NoError(err)
+	assert.True(s.Has(entry.Key))
+	assert.NoError(os.Remove(base + ".mmr"))
+	assert.NoError(os.MkdirAll(filepath.Join(base+".mmr", "blocker"), 0755))
+	_, err = s.Put(rangeProof(0, 1, 1))
+	assert.Error(err)
+	assert.False(s.Has(entry.Key))
+	entries, err = s.List()
+	assert.NoError(err)
+	assert.Equal(0, len(entries))
+	assert.NoError(os.RemoveAll(base + ".mmr"))
+
+	//no temporary files are left behind
+	files, err := os.ReadDir(filepath.Dir(base))
+	assert.NoError(err)
+	for _, f := range files {
+		assert.NotEqual(".", f.Name()[:1], f.Name())
+	}
+}
@@ -0,0 +1,100 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/utils"
+)
+
+// RecursiveVkFp is the hex encoded fingerprint of the block_header_recursive.vk that proofs must
+// come from, as printed by setup-recursive. Pin it at build time with
+//
+//	go build -ldflags "-X github.com/readygo67/BlockHeaderProver/verifier.RecursiveVkFp=<fingerprint>"
+//
+// or set it before calling VerifyHeaderChain.
+var RecursiveVkFp string
+
+// Checkpoint is a block the verifier trusts, with its height and the chain state after it. The
+// circuits take the height and state a chain builds on as given, a proof only vouches for a chain
+// whose begin matches a checkpoint in all three: a forged state could claim an easier target.
+type Checkpoint struct {
+	Hash   [circuits.HashLen]byte
+	Height uint32
+	State  circuits.NativeChainState
+}
+
+// GenesisCheckpoint returns the checkpoint of the genesis block of net.
+func GenesisCheckpoint(net *circuits.Network) Checkpoint {
+	return Checkpoint{Hash: net.GenesisHash, Height: 0, State: net.GenesisState()}
+}
+
+// Verifier verifies recursive proofs of header chains against a pinned vk fingerprint.
+type Verifier struct {
+	VkFp     utils.FingerPrintBytes
+	Solidity bool //proofs are made for the Solidity verifier, see prover.Prover.MergeSolidity
+}
+
+func New(vkFp utils.FingerPrintBytes) *Verifier {
+	return &Verifier{VkFp: vkFp}
+}
+
+// VerifyHeaderChain verifies a recursive proof of a header chain building on the checkpoint
+// expectedBegin, with the verifier pinned to RecursiveVkFp.
+func VerifyHeaderChain(vk native_plonk.VerifyingKey, proof native_plonk.Proof, wit witness.Witness, expectedBegin Checkpoint) (*circuits.PublicWitness, error) {
+	if RecursiveVkFp == "" {
+		return nil, fmt.Errorf("no recursive vk fingerprint pinned")
+	}
+	vkFp, err := hex.DecodeString(RecursiveVkFp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pinned fingerprint: %v", err)
+	}
+	return New(vkFp).Verify(vk, proof, wit, expectedBegin)
+}
+
+// Verify checks that vk is the pinned verifying key, that the proof was made for it, that it
+// verifies and that the proven chain builds on the checkpoint expectedBegin. It returns what the
+// proof proves, the last block of the chain is EndHash.
+func (v *Verifier) Verify(vk native_plonk.VerifyingKey, proof native_plonk.Proof, wit witness.Witness, expectedBegin Checkpoint) (*circuits.PublicWitness, error) {
+	vkFp, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(vkFp, v.VkFp) {
+		return nil, fmt.Errorf("vk fingerprint %x, pinned %x", vkFp, []byte(v.VkFp))
+	}
+
+	public, err := circuits.DecodePublicWitness(wit)
+	if err != nil {
+		return nil, err
+	}
+	//the recursive circuit checks its inner proofs against this fingerprint, a proof of any other
+	//circuit carrying the right vk would vouch for nothing
+	if !bytes.Equal(public.VkFp, v.VkFp) {
+		return nil, fmt.Errorf("proof is for vk fingerprint %x, pinned %x", []byte(public.VkFp), []byte(v.VkFp))
+	}
+	if public.BeginHash != expectedBegin.Hash {
+		return nil, fmt.Errorf("chain builds on %v, expected %v", chainhash.Hash(public.BeginHash), chainhash.Hash(expectedBegin.Hash))
+	}
+	if public.BeginHeight != expectedBegin.Height {
+		return nil, fmt.Errorf("chain builds on height %v, expected %v", public.BeginHeight, expectedBegin.Height)
+	}
+	if public.BeginState != expectedBegin.State {
+		return nil, fmt.Errorf("chain builds on state %+v, expected %+v", public.BeginState, expectedBegin.State)
+	}
+	if public.Count == 0 {
+		return nil, fmt.Errorf("proof of an empty chain")
+	}
+
+	err = operations.PlonkVerify(vk, proof, wit, v.Solidity)
+	if err != nil {
+		return nil, err
+	}
+	return public, nil
+}
@@ -0,0 +1,114 @@
+package verifier
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/consensys/gnark-crypto/ecc"
+	native_plonk "github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+	"github.com/consensys/gnark/std/algebra/emulated/sw_bn254"
+	"github.com/consensys/gnark/test"
+	"github.com/consensys/gnark/test/unsafekzg"
+	"github.com/lightec-xyz/common/operations"
+	"github.com/readygo67/BlockHeaderProver/circuits"
+	"github.com/readygo67/BlockHeaderProver/internal/testutil"
+	"github.com/readygo67/BlockHeaderProver/utils"
+	"testing"
+)
+
+type fakeChain struct {
+	ccs   constraint.ConstraintSystem
+	pk    native_plonk.ProvingKey
+	vk    native_plonk.VerifyingKey
+	vkFp  utils.FingerPrintBytes
+	begin Checkpoint
+}
+
+func newFakeChain(t *testing.T) *fakeChain {
+	assert := test.NewAssert(t)
+
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &testutil.FakeChainCircuit{})
+	assert.NoError(err)
+	srs, lsrs, err := unsafekzg.NewSRS(ccs)
+	assert.NoError(err)
+	pk, vk, err := native_plonk.Setup(ccs, srs, lsrs)
+	assert.NoError(err)
+	vkFp, err := utils.UnsafeFingerPrintFromVk[sw_bn254.ScalarField, sw_bn254.G1Affine, sw_bn254.G2Affine, sw_bn254.GTEl](vk)
+	assert.NoError(err)
+
+	header := testutil.BlockHeaders(t, 1)[0]
+	return &fakeChain{ccs: ccs, pk: pk, vk: vk, vkFp: vkFp, begin: Checkpoint{
+		Hash:   [circuits.HashLen]byte(header[circuits.BeginHashOffset:]),
+		Height: testutil.BeginHeight,
+		State:  testutil.State,
+	}}
+}
+
+// prove proves the public witness of the test headers with vkFp as their fingerprint.
+func (f *fakeChain) prove(t *testing.T, vkFp utils.FingerPrintBytes) (native_plonk.Proof, witness.Witness) {
+	assert := test.NewAssert(t)
+
+	assignment := testutil.NewFakeChainAssignment(t, vkFp)
+	proof, wit, err := operations.PlonkProve(f.ccs, f.pk, assignment, false)
+	assert.NoError(err)
+	return proof, wit
+}
+
+func TestVerifier(t *testing.T) {
+	assert := test.NewAssert(t)
+	f := newFakeChain(t)
+
+	proof, wit := f.prove(t, f.vkFp)
+	public, err := New(f.vkFp).Verify(f.vk, proof, wit, f.begin)
+	assert.NoError(err)
+	assert.Equal(uint32(testutil.BeginHeight), public.BeginHeight)
+	assert.Equal(uint32(2), public.Count)
+	header := testutil.BlockHeaders(t, 2)[1]
+	assert.Equal([circuits.HashLen]byte(chainhash.DoubleHashH(header[:])), public.EndHash)
+
+	//the pinned fingerprint, as set at build time
+	RecursiveVkFp = hex.EncodeToString(f.vkFp)
+	defer func() {
+		RecursiveVkFp = ""
+	}()
+	_, err = VerifyHeaderChain(f.vk, proof, wit, f.begin)
+	assert.NoError(err)
+
+	//another vk than the pinned one
+	other := make([]byte, len(f.vkFp))
+	other[0] = 1
+	_, err = New(other).Verify(f.vk, proof, wit, f.begin)
+	assert.Error(err)
+
+	//a valid proof whose public fingerprint is not the one of its vk
+	proof, wit = f.prove(t, other)
+	assert.NoError(operations.PlonkVerify(f.vk, proof, wit, false))
+	_, err = New(f.vkFp).Verify(f.vk, proof, wit, f.begin)
+	assert.Error(err)
+
+	//a chain building on another block, at another height or from another state
+	proof, wit = f.prove(t, f.vkFp)
+	for _, tamper := range []func(c *Checkpoint){
+		func(c *Checkpoint) { c.Hash = [circuits.HashLen]byte{} },
+		func(c *Checkpoint) { c.Height++ },
+		func(c *Checkpoint) { c.State.EpochBits = 0x2000ffff },
+		func(c *Checkpoint) { c.State.Timestamps[0]++ },
+	} {
+		begin := f.begin
+		tamper(&begin)
+		_, err = New(f.vkFp).Verify(f.vk, proof, wit, begin)
+		assert.Error(err)
+	}
+
+	//a proof that does not verify
+	otherProof, _ := f.prove(t, other)
+	_, err = New(f.vkFp).Verify(f.vk, otherProof, wit, f.begin)
+	assert.Error(err)
+
+	RecursiveVkFp = ""
+	_, err = VerifyHeaderChain(f.vk, proof, wit, f.begin)
+	assert.Error(err)
+}